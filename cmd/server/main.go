@@ -1,10 +1,14 @@
 package main
 
 import (
+	"log"
 	"url-shortener/internal/config"
 	"url-shortener/internal/handler"
+	"url-shortener/internal/mail"
 	"url-shortener/internal/middleware"
 	"url-shortener/internal/models"
+	"url-shortener/internal/service"
+	"url-shortener/internal/tokens"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -13,11 +17,14 @@ import (
 func main() {
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.Default()
+	if err := r.SetTrustedProxies(config.TrustedProxies()); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
 
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Content-Type", "Authorization", "X-Session-Token"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Content-Type", "Authorization", "X-Session-Token", "X-Manage-Token", "X-Workspace-ID"},
 		ExposeHeaders:    []string{"X-Session-Token"},
 		AllowCredentials: true,
 	}))
@@ -25,12 +32,19 @@ func main() {
 
 	config.ConnectDB()
 	config.ConnectRedis()
-	config.DB.AutoMigrate(&models.User{}, &models.URL{}, &models.GuestSession{}, &models.Click{})
+	mail.Setup()
+	tokens.Setup()
+	config.DB.AutoMigrate(&models.User{}, &models.URL{}, &models.GuestSession{}, &models.Click{}, &models.URLVersion{}, &models.RefreshToken{}, &models.RevokedToken{}, &models.UserToken{}, &models.APIKey{}, &models.UserIdentity{}, &models.RecoveryCode{}, &models.Workspace{}, &models.WorkspaceMember{}, &models.WorkspaceInvite{})
+	service.SeedAdmins()
 
 	v1 := r.Group("/api/v1")
 	handler.PingRoutes(v1)
 	handler.RegisterRoutes(v1)
 	handler.URLRoutes(v1)
+	handler.WorkspaceRoutes(v1)
+	handler.AdminRoutes(v1)
+	handler.WellKnownRoutes(r)
+	handler.RedirectRoutes(r)
 
 	// go func() {
 	// 	ticker := time.NewTicker(24 * time.Hour) // Run daily
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// PublicBaseURL is the base that short links are served from, e.g.
+// https://sho.rt. Without PUBLIC_BASE_URL it falls back to the legacy
+// SERVER_URL + /url/redirect route.
+func PublicBaseURL() string {
+	if base := os.Getenv("PUBLIC_BASE_URL"); base != "" {
+		return strings.TrimSuffix(base, "/")
+	}
+	return strings.TrimSuffix(os.Getenv("SERVER_URL"), "/") + "/url/redirect"
+}
+
+// GetEnvInt reads an integer setting, falling back to def when the variable
+// is unset or malformed.
+func GetEnvInt(key string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// TrustedProxies lists the proxies (IPs or CIDRs, comma-separated in
+// TRUSTED_PROXIES) whose X-Forwarded-For header is believed. Without it no
+// proxy is trusted and the client IP is the connection's remote address, so
+// clients can't spoof it to dodge per-IP limits.
+func TrustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
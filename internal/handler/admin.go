@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"url-shortener/internal/middleware"
+	"url-shortener/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminRoutes are for accounts with the global admin role.
+func AdminRoutes(r *gin.RouterGroup) {
+	a := r.Group("/admin", middleware.AuthRequired(), middleware.Authorize(middleware.AdminOnly))
+	a.GET("/users", service.AdminListUsers)
+	a.GET("/users/:id", service.AdminGetUser)
+	a.POST("/users/:id/disable", service.AdminDisableUser)
+	a.POST("/users/:id/enable", service.AdminEnableUser)
+	a.PATCH("/users/:id/role", service.AdminUpdateUserRole)
+	a.GET("/urls", service.AdminListURLs)
+	a.GET("/urls/:code", service.AdminGetURL)
+	a.POST("/urls/:code/disable", service.AdminDisableURL)
+	a.POST("/urls/:code/enable", service.AdminEnableURL)
+}
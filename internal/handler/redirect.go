@@ -0,0 +1,14 @@
+package handler
+
+import (
+	"url-shortener/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RedirectRoutes serves short links at the root of the router, next to the
+// /api group. /api/v1/url/redirect/:code stays as a compatibility alias.
+func RedirectRoutes(r *gin.Engine) {
+	r.GET("/:code", service.RedirectURL)
+	r.POST("/:code/unlock", service.UnlockURL)
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"url-shortener/internal/middleware"
+	"url-shortener/internal/models"
 	"url-shortener/internal/service"
 
 	"github.com/gin-gonic/gin"
@@ -9,9 +10,22 @@ import (
 
 func URLRoutes(r *gin.RouterGroup) {
 	u := r.Group("/url")
-	u.POST("/shorten", middleware.ResolveIdentity(), service.ShortenURL)
-	u.GET("/history", middleware.AuthRequired(), service.GetHistory)
 	u.GET("/redirect/:code", service.RedirectURL) // public route
-	u.DELETE("/:code", middleware.AuthRequired(), service.DeleteURL)
+	u.POST("/redirect/:code/unlock", service.UnlockURL)
+
+	// routes below also accept API keys with the matching scope; the
+	// per-link ones also accept a guest's session or management token.
+	// X-Workspace-ID switches them to a workspace's links.
+	canView := middleware.Authorize(middleware.WorkspaceRole(models.WorkspaceRoleViewer))
+	canEdit := middleware.Authorize(middleware.WorkspaceRole(models.WorkspaceRoleEditor))
+
+	k := u.Group("", middleware.APIKeyAuth())
+	k.POST("/shorten", middleware.RequireScope(models.ScopeLinksWrite), middleware.ResolveIdentity(), canEdit, service.ShortenURL)
+	k.GET("/history", middleware.RequireScope(models.ScopeLinksRead), middleware.AuthRequired(), canView, service.GetHistory)
+	k.PATCH("/:code", middleware.RequireScope(models.ScopeLinksWrite), middleware.ManageAuth(), canEdit, service.UpdateURL)
+	k.DELETE("/:code", middleware.RequireScope(models.ScopeLinksWrite), middleware.ManageAuth(), canEdit, service.DeleteURL)
+	k.GET("/:code/stats", middleware.RequireScope(models.ScopeAnalyticsRead), middleware.ManageAuth(), canView, service.GetURLStats)
+	k.GET("/:code/versions", middleware.RequireScope(models.ScopeLinksRead), middleware.ManageAuth(), canView, service.GetURLVersions)
+	k.POST("/:code/versions/:version/rollback", middleware.RequireScope(models.ScopeLinksWrite), middleware.ManageAuth(), canEdit, service.RollbackURLVersion)
 
 }
@@ -11,5 +11,30 @@ func RegisterRoutes(r *gin.RouterGroup) {
 	u := r.Group("/user")
 	u.POST("/register", service.RegisterUser)
 	u.POST("/login", service.LoginUser)
+	u.POST("/login/mfa", service.LoginMFA)
+	u.GET("/oidc/login", service.OIDCLogin)
+	u.GET("/oidc/callback", service.OIDCCallback)
+	u.POST("/refresh", middleware.RefreshToken)
+	u.GET("/verify", service.VerifyEmail)
+	u.POST("/verify", service.VerifyEmail)
+	u.POST("/verify/resend", middleware.AuthRequired(), service.ResendVerification)
+	u.GET("/unlock", service.UnlockAccount)
+	u.POST("/unlock", service.UnlockAccount)
+	u.POST("/password/forgot", service.ForgotPassword)
+	u.POST("/password/reset", service.ResetPassword)
+	u.POST("/logout", middleware.AuthRequired(), service.Logout)
+	u.POST("/logout-all", middleware.AuthRequired(), service.LogoutAll)
 	u.GET("/get-user", middleware.AuthRequired(), service.GetUsers)
+	u.PATCH("/profile", middleware.AuthRequired(), service.UpdateProfile)
+	u.POST("/password", middleware.AuthRequired(), service.ChangePassword)
+	u.POST("/email", middleware.AuthRequired(), service.ChangeEmail)
+	u.DELETE("/account", middleware.AuthRequired(), service.DeleteAccount)
+	u.POST("/api-keys", middleware.AuthRequired(), service.CreateAPIKey)
+	u.GET("/api-keys", middleware.AuthRequired(), service.ListAPIKeys)
+	u.DELETE("/api-keys/:id", middleware.AuthRequired(), service.RevokeAPIKey)
+	u.POST("/2fa/enroll", middleware.AuthRequired(), service.EnrollTOTP)
+	u.POST("/2fa/confirm", middleware.AuthRequired(), service.ConfirmTOTP)
+	u.POST("/2fa/disable", middleware.AuthRequired(), service.DisableTOTP)
+	u.GET("/identities", middleware.AuthRequired(), service.ListIdentities)
+	u.DELETE("/identities/:id", middleware.AuthRequired(), service.UnlinkIdentity)
 }
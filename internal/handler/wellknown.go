@@ -0,0 +1,13 @@
+package handler
+
+import (
+	"url-shortener/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WellKnownRoutes serves the /.well-known documents at the root of the
+// router.
+func WellKnownRoutes(r *gin.Engine) {
+	r.GET("/.well-known/jwks.json", service.JWKS)
+}
@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"url-shortener/internal/middleware"
+	"url-shortener/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WorkspaceRoutes manages workspaces and their members. Workspace links are
+// served by URLRoutes, picked with the X-Workspace-ID header.
+func WorkspaceRoutes(r *gin.RouterGroup) {
+	w := r.Group("/workspaces", middleware.AuthRequired())
+	w.POST("", service.CreateWorkspace)
+	w.GET("", service.ListWorkspaces)
+	w.POST("/join", service.AcceptWorkspaceInvite)
+	w.DELETE("/:id", service.DeleteWorkspace)
+	w.GET("/:id/members", service.ListWorkspaceMembers)
+	w.PATCH("/:id/members/:user_id", service.UpdateWorkspaceMember)
+	w.DELETE("/:id/members/:user_id", service.RemoveWorkspaceMember)
+	w.POST("/:id/invites", service.InviteWorkspaceMember)
+}
@@ -0,0 +1,40 @@
+package mail
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var logFileMu sync.Mutex
+
+// LogSender doesn't deliver mail. It appends each message to Path, or logs
+// it when Path is empty, which is enough for local development and tests.
+type LogSender struct {
+	Path string
+}
+
+func (s LogSender) Send(to, subject, body string) error {
+	if s.Path == "" {
+		logrus.WithFields(logrus.Fields{
+			"to":      to,
+			"subject": subject,
+		}).Info(body)
+		return nil
+	}
+
+	logFileMu.Lock()
+	defer logFileMu.Unlock()
+
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n\n", time.Now().Format(time.RFC1123Z), to, subject, body)
+	return err
+}
@@ -0,0 +1,36 @@
+package mail
+
+import (
+	"log"
+	"os"
+
+	"url-shortener/internal/config"
+)
+
+// Sender delivers account emails such as verification links.
+type Sender interface {
+	Send(to, subject, body string) error
+}
+
+// Client is the sender used by the services. It logs messages until Setup
+// picks one from the environment.
+var Client Sender = LogSender{}
+
+// Setup configures Client from MAIL_DRIVER: "smtp" sends through SMTP_*,
+// anything else logs messages, to MAIL_LOG_FILE when set.
+func Setup() {
+	switch os.Getenv("MAIL_DRIVER") {
+	case "smtp":
+		Client = SMTPSender{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     config.GetEnvInt("SMTP_PORT", 587),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		}
+		log.Println("Mail configured with SMTP")
+	default:
+		Client = LogSender{Path: os.Getenv("MAIL_LOG_FILE")}
+		log.Println("Mail configured to log messages")
+	}
+}
@@ -0,0 +1,47 @@
+package mail
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"strings"
+)
+
+// SMTPSender sends plain-text mail through an SMTP server. Username may be
+// empty for relays that don't require authentication.
+type SMTPSender struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// Send refuses header values with line breaks, which would let them inject
+// headers of their own; non-ASCII subjects are sent RFC 2047 encoded.
+func (s SMTPSender) Send(to, subject, body string) error {
+	for _, value := range []string{s.From, to, subject} {
+		if strings.ContainsAny(value, "\r\n") {
+			return errors.New("mail header values can't contain line breaks")
+		}
+	}
+
+	msg := strings.Join([]string{
+		"From: " + s.From,
+		"To: " + to,
+		"Subject: " + mime.QEncoding.Encode("UTF-8", subject),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	addr := fmt.Sprintf("%s:%d", s.Host, s.Port)
+	return smtp.SendMail(addr, auth, s.From, []string{to}, []byte(msg))
+}
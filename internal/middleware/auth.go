@@ -1,19 +1,30 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 	"url-shortener/internal/config"
 	"url-shortener/internal/models"
+	"url-shortener/internal/tokens"
+	"url-shortener/internal/util"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func AuthRequired() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if authenticatedByAPIKey(c) {
+			c.Next()
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
@@ -21,85 +32,227 @@ func AuthRequired() gin.HandlerFunc {
 			return
 		}
 
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
-
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
+		if !authenticateBearer(c, authHeader) {
 			return
 		}
-
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			c.Set("token_claims", claims)
-			if userIDFloat, ok := claims["user_id"].(float64); ok {
-				c.Set("user_id", uint(userIDFloat))
-			}
-		}
 		c.Next()
 	}
 }
 
-func GenerateTokens(userID uint) (string, string) {
+// authenticateBearer verifies the access token in an Authorization header and
+// sets the caller's claims and user_id. Otherwise it aborts with a 401.
+func authenticateBearer(c *gin.Context, authHeader string) bool {
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	claims, err := tokens.Parse(tokenString, tokens.TypeAccess)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		c.Abort()
+		return false
+	}
+
+	if IsTokenRevoked(claims) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token revoked"})
+		c.Abort()
+		return false
+	}
+	c.Set("token_claims", claims)
+	if userIDFloat, ok := claims["user_id"].(float64); ok {
+		c.Set("user_id", uint(userIDFloat))
+	}
+	return true
+}
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// GenerateTokens issues an access/refresh pair for a user and records the
+// refresh token. familyID ties the refresh token to the login it descends
+// from; pass "" to start a new family. authTime is when the user last proved
+// who they are, carried in the auth_time claim so sensitive actions can ask
+// for a recent sign-in; refreshing keeps it.
+func GenerateTokens(userID uint, familyID string, authTime time.Time) (string, string, error) {
+	if familyID == "" {
+		familyID = uuid.NewString()
+	}
+	record := models.RefreshToken{
+		UserID:    userID,
+		JTI:       uuid.NewString(),
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(RefreshTokenTTL),
+	}
+
 	accessClaims := jwt.MapClaims{
 		"user_id": userID,
-		"exp":     time.Now().Add(15 * time.Minute).Unix(),
 	}
-
 	refreshClaims := jwt.MapClaims{
 		"user_id": userID,
-		"exp":     time.Now().Add(7 * 24 * time.Hour).Unix(),
+		"jti":     record.JTI,
+		"fam":     familyID,
+	}
+	if !authTime.IsZero() {
+		accessClaims["auth_time"] = authTime.Unix()
+		refreshClaims["auth_time"] = authTime.Unix()
 	}
 
-	accessToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims).
-		SignedString([]byte(os.Getenv("JWT_SECRET")))
+	accessToken, err := tokens.Issue(tokens.TypeAccess, accessClaims, AccessTokenTTL)
+	if err != nil {
+		return "", "", err
+	}
 
-	refreshToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims).
-		SignedString([]byte(os.Getenv("JWT_REFRESH_SECRET")))
+	refreshToken, err := tokens.Issue(tokens.TypeRefresh, refreshClaims, RefreshTokenTTL)
+	if err != nil {
+		return "", "", err
+	}
 
-	return accessToken, refreshToken
+	if err := config.DB.Create(&record).Error; err != nil {
+		return "", "", err
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+// GuestSessionToken is the browser's guest session token: the one a handler
+// recovered from a signed login step (set as session_token), else the
+// X-Session-Token header.
+func GuestSessionToken(c *gin.Context) string {
+	if token := c.GetString("session_token"); token != "" {
+		return token
+	}
+	return c.GetHeader("X-Session-Token")
 }
 
-func LinkSessionToUser(c *gin.Context, userID uint) {
-	sessionToken := c.GetHeader("X-Session-Token")
+// LinkSessionToUser moves the links of the browser's guest session (see
+// GuestSessionToken) to the user and retires the session. Their management
+// tokens stop working, as the account now controls them. It returns how many
+// links were claimed; without a live session that's 0.
+func LinkSessionToUser(c *gin.Context, userID uint) (int64, error) {
+	sessionToken := GuestSessionToken(c)
 	if sessionToken == "" {
-		return
+		return 0, nil
 	}
 
-	// update urls
-	config.DB.Model(&models.URL{}).
-		Where("session_token = ?", sessionToken).
-		Update("user_id", userID)
+	var claimed int64
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// the row lock makes a concurrent claim of the same session wait
+		// and then find it gone
+		var session models.GuestSession
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token = ? AND expires_at > ?", sessionToken, time.Now()).
+			First(&session).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.URL{}).
+			Where("session_id = ?", session.ID).
+			Updates(map[string]interface{}{
+				"user_id":           userID,
+				"session_id":        nil,
+				"manage_token_hash": "",
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		claimed = result.RowsAffected
 
-	// clear session token
-	config.DB.Model(&models.URL{}).
-		Where("session_token = ?", sessionToken).
-		Update("session_token", nil)
+		return tx.Delete(&session).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return claimed, nil
 }
 
+// RefreshToken rotates a refresh token: the presented token is marked used
+// and a new pair from the same family is returned. A token that was already
+// used or revoked means it leaked, so its whole family is revoked.
 func RefreshToken(c *gin.Context) {
 	var input struct {
-		RefreshToken string `json:"refresh_token"`
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
 	}
-	c.ShouldBindJSON(&input)
 
-	token, err := jwt.Parse(input.RefreshToken, func(t *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("JWT_REFRESH_SECRET")), nil
-	})
+	claims, err := tokens.Parse(input.RefreshToken, tokens.TypeRefresh)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, util.ResponseError("invalid refresh token"))
+		return
+	}
+
+	jti, _ := claims["jti"].(string)
+
+	var record models.RefreshToken
+	if err := config.DB.Where("jti = ?", jti).First(&record).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, util.ResponseError("invalid refresh token"))
+		return
+	}
+
+	// tokens revoked by a logout, password change or admin are simply
+	// invalid; only presenting a used one means it leaked
+	if record.RevokedAt != nil {
+		c.JSON(http.StatusUnauthorized, util.ResponseError("invalid refresh token"))
+		return
+	}
+
+	var user models.User
+	if err := config.DB.Select("id", "disabled_at").First(&user, record.UserID).Error; err != nil || user.DisabledAt != nil {
+		c.JSON(http.StatusUnauthorized, util.ResponseError("invalid refresh token"))
+		return
+	}
 
-	if err != nil || !token.Valid {
-		c.JSON(401, gin.H{"error": "invalid refresh token"})
+	// claim the token in a single conditional UPDATE so two concurrent
+	// refreshes can't both succeed
+	result := config.DB.Model(&models.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", record.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(result.Error.Error()))
 		return
 	}
+	if result.RowsAffected == 0 {
+		// revoked since it was loaded rather than used
+		if err := config.DB.First(&record, record.ID).Error; err != nil || record.UsedAt == nil {
+			c.JSON(http.StatusUnauthorized, util.ResponseError("invalid refresh token"))
+			return
+		}
 
-	claims := token.Claims.(jwt.MapClaims)
-	userID := uint(claims["user_id"].(float64))
+		RevokeTokenFamily(record.FamilyID)
+		logrus.WithFields(logrus.Fields{
+			"user_id":   record.UserID,
+			"family_id": record.FamilyID,
+			"client_ip": c.ClientIP(),
+		}).Warn("Refresh token reuse detected, token family revoked")
+		c.JSON(http.StatusUnauthorized, util.ResponseError("refresh token reuse detected"))
+		return
+	}
 
-	access, refresh := GenerateTokens(userID)
-	c.JSON(200, gin.H{
+	var authTime time.Time
+	if unix, ok := claims["auth_time"].(float64); ok {
+		authTime = time.Unix(int64(unix), 0)
+	}
+	access, refresh, err := GenerateTokens(record.UserID, record.FamilyID, authTime)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError("failed to issue tokens"))
+		return
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
 		"access_token":  access,
 		"refresh_token": refresh,
-	})
+		"expires_in":    int(AccessTokenTTL.Seconds()),
+	}))
+}
+
+// RevokeTokenFamily revokes every outstanding refresh token of a family.
+func RevokeTokenFamily(familyID string) {
+	config.DB.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now())
 }
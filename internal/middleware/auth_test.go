@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"url-shortener/internal/config"
+	"url-shortener/internal/models"
+	"url-shortener/internal/tokens"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"gorm.io/gorm"
+)
+
+// setupAuthTest points config.DB at a fresh SQLite database, signs tokens
+// with a test secret and returns a user to issue them for.
+func setupAuthTest(t *testing.T) models.User {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		TranslateError: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.RevokedToken{}); err != nil {
+		t.Fatal(err)
+	}
+	prevDB, prevRedis := config.DB, config.RedisClient
+	config.DB, config.RedisClient = db, nil
+	t.Cleanup(func() { config.DB, config.RedisClient = prevDB, prevRedis })
+
+	t.Setenv("JWT_ALG", "HS256")
+	t.Setenv("JWT_SECRET", "test-secret")
+	tokens.Setup()
+
+	user := models.User{Email: "jane@example.com", Name: "Jane", Password: "hash"}
+	if err := config.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func refresh(t *testing.T, refreshToken string) (int, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/user/refresh",
+		strings.NewReader(`{"refresh_token":"`+refreshToken+`"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	RefreshToken(c)
+
+	var body models.APIResponse
+	json.Unmarshal(w.Body.Bytes(), &body)
+	return w.Code, body.Message
+}
+
+// captureLogs records what the global logger logs during the test.
+func captureLogs(t *testing.T) *logtest.Hook {
+	t.Helper()
+	prev := logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+	t.Cleanup(func() { logrus.StandardLogger().ReplaceHooks(prev) })
+	return logtest.NewGlobal()
+}
+
+func reuseLogged(hook *logtest.Hook) bool {
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.WarnLevel && strings.Contains(entry.Message, "reuse") {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRefreshAfterLogoutIsNotReuse(t *testing.T) {
+	revocations := map[string]func(user models.User, family string){
+		"logout":     func(_ models.User, family string) { RevokeTokenFamily(family) },
+		"logout-all": func(user models.User, _ string) { RevokeUserTokens(user.ID) },
+	}
+	for name, revoke := range revocations {
+		t.Run(name, func(t *testing.T) {
+			user := setupAuthTest(t)
+			hook := captureLogs(t)
+
+			_, refreshToken, err := GenerateTokens(user.ID, "fam-1", time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			revoke(user, "fam-1")
+
+			status, message := refresh(t, refreshToken)
+			if status != http.StatusUnauthorized || message != "invalid refresh token" {
+				t.Errorf("refresh = %d %q, want 401 \"invalid refresh token\"", status, message)
+			}
+			if reuseLogged(hook) {
+				t.Error("a revoked token was logged as reuse")
+			}
+		})
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	user := setupAuthTest(t)
+	hook := captureLogs(t)
+
+	_, first, err := GenerateTokens(user.ID, "fam-1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, message := refresh(t, first); status != http.StatusOK {
+		t.Fatalf("first refresh = %d %q", status, message)
+	}
+
+	status, message := refresh(t, first)
+	if status != http.StatusUnauthorized || message != "refresh token reuse detected" {
+		t.Errorf("replay = %d %q, want 401 \"refresh token reuse detected\"", status, message)
+	}
+	if !reuseLogged(hook) {
+		t.Error("reuse was not logged")
+	}
+
+	var live int64
+	config.DB.Model(&models.RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", "fam-1").Count(&live)
+	if live != 0 {
+		t.Errorf("%d tokens of the family still live after reuse", live)
+	}
+}
@@ -1,58 +1,52 @@
 package middleware
 
 import (
-	"os"
+	"math"
+	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"url-shortener/internal/config"
 	"url-shortener/internal/models"
+	"url-shortener/internal/tokens"
+	"url-shortener/internal/util"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
+const guestSessionWindow = 24 * time.Hour
+
 func ResolveIdentity() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if authenticatedByAPIKey(c) {
+			c.Next()
+			return
+		}
 
 		authHeader := c.GetHeader("Authorization")
 		if authHeader != "" {
 			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-			token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-				return []byte(os.Getenv("JWT_SECRET")), nil
-			})
-
-			if err == nil && token.Valid {
-				if claims, ok := token.Claims.(jwt.MapClaims); ok {
-					c.Set("user_id", uint(claims["user_id"].(float64)))
+			claims, err := tokens.Parse(tokenString, tokens.TypeAccess)
+			if err == nil && !IsTokenRevoked(claims) {
+				if userID, ok := claims["user_id"].(float64); ok {
+					c.Set("user_id", uint(userID))
 					c.Next()
 					return
 				}
 			}
 		}
-		sessionToken := c.GetHeader("X-Session-Token")
-		if sessionToken != "" {
-			var session models.GuestSession
-			err := config.DB.
-				Where("token = ?", sessionToken).
-				First(&session).Error
-
-			if err == nil && !session.ExpiresAt.IsZero() && time.Now().Before(session.ExpiresAt) {
-
-				newExpiresAt := time.Now().Add(30 * 24 * time.Hour)
-				now := time.Now()
-
-				config.DB.Model(&session).Updates(map[string]interface{}{
-					"last_accessed": now,
-					"expires_at":    newExpiresAt,
-				})
-
-				c.Set("session_id", session.ID)
-				c.Set("session_token", session.Token)
-				c.Next()
-				return
-			}
+		if session, ok := activeGuestSession(c); ok {
+			c.Set("session_id", session.ID)
+			c.Set("session_token", session.Token)
+			c.Next()
+			return
+		}
+
+		if !guestSessionAllowed(c) {
+			c.Abort()
+			return
 		}
 
 		token := uuid.NewString()
@@ -60,6 +54,7 @@ func ResolveIdentity() gin.HandlerFunc {
 		session := models.GuestSession{
 			Token:     token,
 			ExpiresAt: expiresAt,
+			IP:        util.ClientNetwork(c),
 		}
 		config.DB.Create(&session)
 
@@ -70,3 +65,69 @@ func ResolveIdentity() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// activeGuestSession loads the unexpired guest session named by the
+// X-Session-Token header and extends it, as sessions expire after 30 days
+// without use.
+func activeGuestSession(c *gin.Context) (models.GuestSession, bool) {
+	var session models.GuestSession
+
+	sessionToken := c.GetHeader("X-Session-Token")
+	if sessionToken == "" {
+		return session, false
+	}
+
+	err := config.DB.
+		Where("token = ?", sessionToken).
+		First(&session).Error
+	if err != nil || session.ExpiresAt.IsZero() || !time.Now().Before(session.ExpiresAt) {
+		return session, false
+	}
+
+	newExpiresAt := time.Now().Add(30 * 24 * time.Hour)
+	now := time.Now()
+
+	config.DB.Model(&session).Updates(map[string]interface{}{
+		"last_accessed": now,
+		"expires_at":    newExpiresAt,
+	})
+	return session, true
+}
+
+// guestSessionAllowed caps how many guest sessions one IP may start per
+// rolling day (GUEST_SESSIONS_PER_IP_PER_DAY, 0 = no limit), so clients can't
+// dodge the per-session link quotas by dropping their token. It writes the
+// 429 itself.
+func guestSessionAllowed(c *gin.Context) bool {
+	limit := config.GetEnvInt("GUEST_SESSIONS_PER_IP_PER_DAY", 20)
+	if limit <= 0 {
+		return true
+	}
+
+	network := util.ClientNetwork(c)
+	since := time.Now().Add(-guestSessionWindow)
+	var count int64
+	err := config.DB.Model(&models.GuestSession{}).Unscoped().
+		Where("ip = ? AND created_at > ?", network, since).
+		Count(&count).Error
+	if err != nil || count < int64(limit) {
+		return true
+	}
+
+	meta := gin.H{
+		"reason": "guest_session_limit",
+		"scope":  "ip",
+		"period": "day",
+		"limit":  limit,
+	}
+	var oldest time.Time
+	config.DB.Model(&models.GuestSession{}).Unscoped().
+		Where("ip = ? AND created_at > ?", network, since).
+		Select("MIN(created_at)").Scan(&oldest)
+	if retryAfter := int(math.Ceil(time.Until(oldest.Add(guestSessionWindow)).Seconds())); retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		meta["retry_after"] = retryAfter
+	}
+	c.JSON(http.StatusTooManyRequests, util.ResponseErrorMeta("too many guest sessions from this address, sign up to continue", meta))
+	return false
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ManageAuth guards the routes that manage a single link. Besides a user's
+// access token or API key it accepts the link's management token in
+// X-Manage-Token, or the guest session that created the link in
+// X-Session-Token. Which link they unlock is up to the handler.
+func ManageAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if authenticatedByAPIKey(c) {
+			c.Next()
+			return
+		}
+
+		if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+			if authenticateBearer(c, authHeader) {
+				c.Next()
+			}
+			return
+		}
+
+		manageToken := c.GetHeader("X-Manage-Token")
+		if manageToken != "" {
+			c.Set("manage_token", manageToken)
+		}
+		if session, ok := activeGuestSession(c); ok {
+			c.Set("session_id", session.ID)
+			c.Set("session_token", session.Token)
+		}
+
+		if manageToken == "" && c.GetUint("session_id") == 0 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization, X-Manage-Token or X-Session-Token header required"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+	"url-shortener/internal/config"
+	"url-shortener/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Revocations are written to both Redis and the database. Redis only speeds
+// up the positive answer: a key can be missing because it was evicted or its
+// write failed, so a miss falls through to the database, which is the record
+// of truth.
+
+func revokedTokenKey(jti string) string {
+	return "revoked:jti:" + jti
+}
+
+func revokedUserKey(userID uint) string {
+	return fmt.Sprintf("revoked:user:%d", userID)
+}
+
+// RevokeToken revokes a single access token until it would have expired.
+func RevokeToken(jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if jti == "" || ttl <= 0 {
+		return nil
+	}
+
+	record := models.RevokedToken{JTI: jti, ExpiresAt: expiresAt}
+	if err := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&record).Error; err != nil {
+		return err
+	}
+
+	if config.RedisClient != nil {
+		if err := config.RedisClient.Set(context.Background(), revokedTokenKey(jti), 1, ttl).Err(); err != nil {
+			logrus.WithError(err).Warn("Failed to cache token revocation")
+		}
+	}
+	return nil
+}
+
+// RevokeUserTokens logs a user out everywhere: every token issued before now
+// stops being accepted and all of the user's refresh tokens are revoked.
+func RevokeUserTokens(userID uint) error {
+	now := time.Now()
+
+	if err := config.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Update("tokens_revoked_at", now).Error; err != nil {
+		return err
+	}
+
+	if err := config.DB.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+
+	if config.RedisClient != nil {
+		if err := config.RedisClient.Set(context.Background(), revokedUserKey(userID), now.Unix(), RefreshTokenTTL).Err(); err != nil {
+			logrus.WithError(err).WithField("user_id", userID).Warn("Failed to cache token revocation")
+		}
+	}
+	return nil
+}
+
+// IsTokenRevoked reports whether the access token described by claims was
+// revoked, either on its own or by a log-out-everywhere for its user. Tokens
+// of deleted accounts count as revoked.
+func IsTokenRevoked(claims jwt.MapClaims) bool {
+	if jti, ok := claims["jti"].(string); ok && tokenRevoked(jti) {
+		return true
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return false
+	}
+	revokedAt, err := userTokensRevokedAt(uint(userID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return true
+	}
+	if err != nil || revokedAt.IsZero() {
+		return false
+	}
+
+	issuedAt, ok := claims["iat"].(float64)
+	return !ok || int64(issuedAt) < revokedAt.Unix()
+}
+
+func tokenRevoked(jti string) bool {
+	if config.RedisClient != nil {
+		if err := config.RedisClient.Get(context.Background(), revokedTokenKey(jti)).Err(); err == nil {
+			return true
+		}
+	}
+
+	var count int64
+	config.DB.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count)
+	return count > 0
+}
+
+// userTokensRevokedAt returns when all of the user's tokens were last
+// revoked, or the zero time if never. It returns gorm.ErrRecordNotFound once
+// the user has been deleted.
+func userTokensRevokedAt(userID uint) (time.Time, error) {
+	if config.RedisClient != nil {
+		value, err := config.RedisClient.Get(context.Background(), revokedUserKey(userID)).Result()
+		if err == nil {
+			if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+				return time.Unix(unix, 0), nil
+			}
+		}
+	}
+
+	var user models.User
+	if err := config.DB.Select("tokens_revoked_at").First(&user, userID).Error; err != nil {
+		return time.Time{}, err
+	}
+	if user.TokensRevokedAt == nil {
+		return time.Time{}, nil
+	}
+	return *user.TokensRevokedAt, nil
+}
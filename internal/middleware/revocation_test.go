@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"url-shortener/internal/config"
+	"url-shortener/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func authenticate(accessToken string) int {
+	r := gin.New()
+	r.GET("/me", AuthRequired(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestAccessTokenRejectedAfterAccountDeletion(t *testing.T) {
+	user := setupAuthTest(t)
+
+	accessToken, _, err := GenerateTokens(user.ID, "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := authenticate(accessToken); status != http.StatusOK {
+		t.Fatalf("before deletion = %d, want 200", status)
+	}
+
+	// as DeleteAccount does, without Redis to remember the revocation
+	if err := RevokeUserTokens(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.DB.Unscoped().Delete(&models.User{}, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if status := authenticate(accessToken); status != http.StatusUnauthorized {
+		t.Errorf("after deletion = %d, want 401", status)
+	}
+}
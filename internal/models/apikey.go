@@ -0,0 +1,32 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	ScopeLinksWrite    = "links:write"
+	ScopeLinksRead     = "links:read"
+	ScopeAnalyticsRead = "analytics:read"
+)
+
+var APIKeyScopes = []string{ScopeLinksWrite, ScopeLinksRead, ScopeAnalyticsRead}
+
+// APIKey is a personal key for programmatic access. Only a hash of the key is
+// stored; Prefix is kept so users can tell their keys apart.
+type APIKey struct {
+	ID         uint   `gorm:"primaryKey"`
+	UserID     uint   `gorm:"not null;index"`
+	Name       string `gorm:"not null"`
+	Prefix     string `gorm:"not null"`
+	KeyHash    string `gorm:"uniqueIndex;not null"`
+	Scopes     string `gorm:"not null"` // space separated
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+func (k APIKey) ScopeList() []string {
+	return strings.Fields(k.Scopes)
+}
@@ -11,6 +11,7 @@ type Click struct {
 	URLID     uint      `json:"url_id" gorm:"not null;index"`
 	IP        string    `json:"ip"`
 	UserAgent string    `json:"user_agent"`
+	Fallback  bool      `json:"fallback" gorm:"not null;default:false"`
 	Timestamp time.Time `json:"timestamp" gorm:"default:CURRENT_TIMESTAMP"`
 	URL       URL       `gorm:"foreignKey:URLID"`
 }
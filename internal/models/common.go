@@ -10,11 +10,48 @@ type APIResponse struct {
 }
 
 type HistoryItem struct {
-	ID          uint       `json:"id"`
-	OriginalURL string     `json:"original_url"`
-	ShortCode   string     `json:"short_code"`
-	ShortURL    string     `json:"short_url"`
-	Clicks      int        `json:"clicks"`
-	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
-	CreatedAt   time.Time  `json:"created_at"`
+	ID                uint       `json:"id"`
+	OriginalURL       string     `json:"original_url"`
+	ShortCode         string     `json:"short_code"`
+	ShortURL          string     `json:"short_url"`
+	WorkspaceID       *uint      `json:"workspace_id,omitempty"`
+	CreatedByUserID   *uint      `json:"created_by_user_id,omitempty"`
+	Clicks            int        `json:"clicks"`
+	MaxClicks         *int       `json:"max_clicks,omitempty"`
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"`
+	ActiveFrom        *time.Time `json:"active_from,omitempty"`
+	PasswordProtected bool       `json:"password_protected"`
+	FallbackURL       string     `json:"fallback_url,omitempty"`
+	RedirectStatus    int        `json:"redirect_status"`
+	DisabledAt        *time.Time `json:"disabled_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+type APIKeyItem struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// UserItem is an account as shown to admins.
+type UserItem struct {
+	ID              uint       `json:"id"`
+	Email           string     `json:"email"`
+	Name            string     `json:"name"`
+	Role            string     `json:"role"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	TOTPEnabled     bool       `json:"totp_enabled"`
+	DisabledAt      *time.Time `json:"disabled_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// AdminURLItem is a link as shown to admins, with who it belongs to.
+type AdminURLItem struct {
+	HistoryItem
+	UserID    *uint `json:"user_id"`
+	SessionID *uint `json:"session_id"`
 }
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// UserIdentity links an account to a login at an OpenID Connect provider.
+type UserIdentity struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"-" gorm:"not null;index"`
+	Issuer      string     `json:"issuer" gorm:"not null;uniqueIndex:idx_identity_issuer_subject"`
+	Subject     string     `json:"subject" gorm:"not null;uniqueIndex:idx_identity_issuer_subject"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
@@ -11,6 +11,7 @@ type GuestSession struct {
 	Token        string         `gorm:"uniqueIndex;not null"`
 	ExpiresAt    time.Time      `gorm:"column:expires_at;not null"`
 	LastAccessed *time.Time     `gorm:"column:last_accessed"`
+	IP           string         `gorm:"column:ip;index"`
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
 	DeletedAt    gorm.DeletedAt `gorm:"index"`
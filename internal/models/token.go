@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// RefreshToken tracks an issued refresh token. Tokens rotated from the same
+// login share a FamilyID, so presenting one that was already used can revoke
+// every token descended from that login.
+type RefreshToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null;index"`
+	JTI       string    `gorm:"column:jti;uniqueIndex;not null"`
+	FamilyID  string    `gorm:"index;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+// RevokedToken is the durable record of an access token revoked before its
+// expiry. Redis holds the same entries for the per-request check.
+type RevokedToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	JTI       string    `gorm:"column:jti;uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"index;not null"`
+	CreatedAt time.Time
+}
+
+const (
+	TokenPurposeVerifyEmail   = "verify_email"
+	TokenPurposePasswordReset = "password_reset"
+	TokenPurposeChangeEmail   = "change_email"
+	TokenPurposeUnlockAccount = "unlock_account"
+)
+
+// UserToken is a single-use token mailed to a user, such as an email
+// verification link. Only a hash of the token is stored.
+type UserToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null;index"`
+	Purpose   string    `gorm:"not null"`
+	TokenHash string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+	// Email is the address a change_email token was mailed to
+	Email string
+}
+
+// RecoveryCode is a hashed single-use code that stands in for a TOTP code
+// when the authenticator is lost.
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	CodeHash  string `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
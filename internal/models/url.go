@@ -8,13 +8,22 @@ import (
 
 type URL struct {
 	gorm.Model
-	OriginalURL  string       `json:"original_url" validate:"required,url"`
-	ShortCode    string       `json:"short_code" gorm:"unique;not null"`
-	UserID       *uint        `json:"user_id" gorm:"index"`
-	SessionID    *uint        `json:"session_id" gorm:"index"`
-	Clicks       int          `json:"clicks" gorm:"default:0;check:clicks >= 0"`
-	ExpiresAt    *time.Time   `json:"expires_at"`
-	User         User         `gorm:"foreignKey:UserID"`
-	GuestSession GuestSession `gorm:"foreignKey:SessionID"`
-	ClicksData   []Click      `gorm:"foreignKey:URLID"`
+	OriginalURL    string       `json:"original_url" validate:"required,url"`
+	ShortCode      string       `json:"short_code" gorm:"unique;not null"`
+	UserID         *uint        `json:"user_id" gorm:"index"`
+	SessionID      *uint        `json:"session_id" gorm:"index"`
+	WorkspaceID    *uint        `json:"workspace_id" gorm:"index"`
+	Clicks         int          `json:"clicks" gorm:"default:0;check:clicks >= 0"`
+	MaxClicks      *int         `json:"max_clicks"`
+	ExpiresAt      *time.Time   `json:"expires_at"`
+	ActiveFrom     *time.Time   `json:"active_from"`
+	Password       string       `json:"-"`
+	FallbackURL    string       `json:"fallback_url"`
+	RedirectStatus int          `json:"redirect_status" gorm:"not null;default:0"`
+	CreatorIP      string       `json:"-" gorm:"index"`
+	ManageToken    string       `json:"-" gorm:"column:manage_token_hash;index"`
+	DisabledAt     *time.Time   `json:"disabled_at"`
+	User           User         `gorm:"foreignKey:UserID"`
+	GuestSession   GuestSession `gorm:"foreignKey:SessionID"`
+	ClicksData     []Click      `gorm:"foreignKey:URLID"`
 }
@@ -1,10 +1,35 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
 
 type User struct {
 	gorm.Model
 	Email    string `json:"email" gorm:"unique" validate:"required,email"`
 	Name     string `json:"name" validate:"required"`
 	Password string `json:"password" validate:"required,min=6"`
+
+	EmailVerifiedAt    *time.Time `json:"email_verified_at"`
+	PendingEmail       string     `json:"pending_email,omitempty"`
+	DefaultFallbackURL string     `json:"default_fallback_url"`
+	// TokensRevokedAt invalidates every token issued before it
+	TokensRevokedAt *time.Time `json:"-"`
+
+	// TOTPSecret is set on enrollment; 2FA is on once TOTPEnabledAt is set
+	TOTPSecret    string     `json:"-"`
+	TOTPEnabledAt *time.Time `json:"totp_enabled_at"`
+	TOTPLastStep  int64      `json:"-"`
+
+	// Role is RoleUser or RoleAdmin. A disabled account can't sign in,
+	// refresh tokens or use its API keys.
+	Role       string     `json:"role" gorm:"not null;default:user"`
+	DisabledAt *time.Time `json:"disabled_at"`
 }
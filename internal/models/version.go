@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// URLVersion is an append-only record of a change to a link's destination.
+// The first row for a link has an empty OldURL and holds the destination it
+// was created with.
+type URLVersion struct {
+	ID                 uint      `json:"id" gorm:"primaryKey"`
+	URLID              uint      `json:"url_id" gorm:"not null;index"`
+	OldURL             string    `json:"old_url"`
+	NewURL             string    `json:"new_url" gorm:"not null"`
+	ChangedByUserID    *uint     `json:"changed_by_user_id"`
+	ChangedBySessionID *uint     `json:"changed_by_session_id"`
+	CreatedAt          time.Time `json:"created_at"`
+}
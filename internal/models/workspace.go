@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+const (
+	WorkspaceRoleOwner  = "owner"
+	WorkspaceRoleEditor = "editor"
+	WorkspaceRoleViewer = "viewer"
+)
+
+var WorkspaceRoles = []string{WorkspaceRoleOwner, WorkspaceRoleEditor, WorkspaceRoleViewer}
+
+// viewers see a workspace's links and stats, editors also create and change
+// them, owners also manage members and invites
+var workspaceRoleRank = map[string]int{
+	WorkspaceRoleViewer: 1,
+	WorkspaceRoleEditor: 2,
+	WorkspaceRoleOwner:  3,
+}
+
+// Workspace is a team that owns links together. Links with a WorkspaceID
+// belong to it; their UserID only records who created them.
+type Workspace struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type WorkspaceMember struct {
+	ID          uint      `json:"-" gorm:"primaryKey"`
+	WorkspaceID uint      `json:"workspace_id" gorm:"not null;uniqueIndex:idx_workspace_member"`
+	UserID      uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_workspace_member;index"`
+	Role        string    `json:"role" gorm:"not null"`
+	CreatedAt   time.Time `json:"joined_at"`
+}
+
+// HasRole reports whether the member's role is at least min.
+func (m WorkspaceMember) HasRole(min string) bool {
+	return workspaceRoleRank[m.Role] >= workspaceRoleRank[min]
+}
+
+// WorkspaceInvite is an emailed invitation to join a workspace. Only a hash
+// of its token is stored, and it can be accepted once, by the account with
+// the invited email.
+type WorkspaceInvite struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	WorkspaceID     uint       `json:"workspace_id" gorm:"not null;index"`
+	Email           string     `json:"email" gorm:"not null"`
+	Role            string     `json:"role" gorm:"not null"`
+	TokenHash       string     `json:"-" gorm:"uniqueIndex;not null"`
+	InvitedByUserID uint       `json:"invited_by_user_id"`
+	ExpiresAt       time.Time  `json:"expires_at" gorm:"not null"`
+	AcceptedAt      *time.Time `json:"accepted_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
@@ -0,0 +1,352 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID     = "client-1"
+	testClientSecret = "secret-1"
+	testRedirectURL  = "https://app.example/callback"
+)
+
+// fakeIdP is an OpenID provider serving discovery, a JWKS and a token
+// endpoint that redeems one authorization code.
+type fakeIdP struct {
+	*httptest.Server
+
+	issuer    string // served in discovery; the server URL when empty
+	mu        sync.Mutex
+	keys      map[string]crypto.Signer // published in the JWKS
+	jwksHits  int
+	code      string
+	challenge string
+	idToken   string
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	idp := &fakeIdP{keys: map[string]crypto.Signer{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		issuer := idp.issuer
+		if issuer == "" {
+			issuer = idp.URL
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		idp.jwksHits++
+
+		keys := []map[string]string{}
+		for kid, signer := range idp.keys {
+			keys = append(keys, publicJWK(kid, signer.Public()))
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+
+		r.ParseForm()
+		valid := r.PostForm.Get("grant_type") == "authorization_code" &&
+			r.PostForm.Get("code") == idp.code &&
+			r.PostForm.Get("redirect_uri") == testRedirectURL &&
+			r.PostForm.Get("client_id") == testClientID &&
+			r.PostForm.Get("client_secret") == testClientSecret &&
+			Challenge(r.PostForm.Get("code_verifier")) == idp.challenge
+		if !valid {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error":             "invalid_grant",
+				"error_description": "bad code or verifier",
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idp.idToken})
+	})
+
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func (idp *fakeIdP) addKey(kid string, signer crypto.Signer) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.keys[kid] = signer
+}
+
+func (idp *fakeIdP) removeKey(kid string) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	delete(idp.keys, kid)
+}
+
+func (idp *fakeIdP) hits() int {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	return idp.jwksHits
+}
+
+// claims are valid ID token claims for the test client, to be tweaked by
+// each case.
+func (idp *fakeIdP) claims(nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            idp.URL,
+		"aud":            testClientID,
+		"sub":            "user-123",
+		"email":          "jane@example.com",
+		"email_verified": true,
+		"name":           "Jane",
+		"nonce":          nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	}
+}
+
+func sign(t *testing.T, kid string, signer crypto.Signer, claims jwt.MapClaims) string {
+	t.Helper()
+	method := jwt.SigningMethod(jwt.SigningMethodRS256)
+	if _, ok := signer.(*ecdsa.PrivateKey); ok {
+		method = jwt.SigningMethodES256
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	raw, err := token.SignedString(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func publicJWK(kid string, public crypto.PublicKey) map[string]string {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kid": kid, "kty": "RSA", "use": "sig",
+			"n": b64(pub.N.Bytes()), "e": b64(big.NewInt(int64(pub.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		return map[string]string{"kid": kid, "kty": "EC", "use": "sig", "crv": "P-256",
+			"x": b64(pub.X.FillBytes(make([]byte, 32))), "y": b64(pub.Y.FillBytes(make([]byte, 32)))}
+	}
+	panic("unsupported key type")
+}
+
+func rsaKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func ecKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func discover(t *testing.T, idp *fakeIdP) *Provider {
+	t.Helper()
+	p, err := Discover(context.Background(), idp.URL, testClientID, testClientSecret, testRedirectURL)
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	return p
+}
+
+func TestDiscover(t *testing.T) {
+	idp := newFakeIdP(t)
+	p := discover(t, idp)
+
+	if p.Issuer != idp.URL {
+		t.Errorf("Issuer = %q, want %q", p.Issuer, idp.URL)
+	}
+
+	authURL := p.AuthCodeURL("st", "nc", "ch")
+	for _, want := range []string{idp.URL + "/authorize?", "state=st", "nonce=nc", "code_challenge=ch", "code_challenge_method=S256", "client_id=" + testClientID} {
+		if !strings.Contains(authURL, want) {
+			t.Errorf("AuthCodeURL %q is missing %q", authURL, want)
+		}
+	}
+}
+
+func TestDiscoverIssuerMismatch(t *testing.T) {
+	idp := newFakeIdP(t)
+	idp.issuer = "https://other.example"
+
+	if _, err := Discover(context.Background(), idp.URL, testClientID, testClientSecret, testRedirectURL); err == nil {
+		t.Fatal("Discover accepted a document for a different issuer")
+	}
+}
+
+func TestExchange(t *testing.T) {
+	idp := newFakeIdP(t)
+	p := discover(t, idp)
+
+	verifier := NewVerifier()
+	idp.code, idp.challenge, idp.idToken = "code-1", Challenge(verifier), "the-id-token"
+
+	got, err := p.Exchange(context.Background(), "code-1", verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if got != "the-id-token" {
+		t.Errorf("Exchange = %q, want the-id-token", got)
+	}
+
+	if _, err := p.Exchange(context.Background(), "code-1", NewVerifier()); err == nil {
+		t.Error("Exchange succeeded with the wrong PKCE verifier")
+	}
+	if _, err := p.Exchange(context.Background(), "code-2", verifier); err == nil {
+		t.Error("Exchange succeeded with an unknown code")
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	idp := newFakeIdP(t)
+	key := rsaKey(t)
+	idp.addKey("k1", key)
+	p := discover(t, idp)
+
+	claims, err := p.VerifyIDToken(context.Background(), sign(t, "k1", key, idp.claims("n1")), "n1")
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	want := Claims{Subject: "user-123", Email: "jane@example.com", EmailVerified: true, Name: "Jane"}
+	if *claims != want {
+		t.Errorf("claims = %+v, want %+v", *claims, want)
+	}
+
+	tests := []struct {
+		name   string
+		kid    string
+		signer crypto.Signer
+		modify func(jwt.MapClaims)
+		nonce  string
+	}{
+		{name: "bad nonce", nonce: "other"},
+		{name: "missing nonce", modify: func(c jwt.MapClaims) { delete(c, "nonce") }},
+		{name: "bad audience", modify: func(c jwt.MapClaims) { c["aud"] = "someone-else" }},
+		{name: "bad issuer", modify: func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }},
+		{name: "expired", modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{name: "no expiry", modify: func(c jwt.MapClaims) { delete(c, "exp") }},
+		{name: "missing subject", modify: func(c jwt.MapClaims) { delete(c, "sub") }},
+		{name: "unknown kid", kid: "k9", signer: ecKey(t)},
+		{name: "known kid, wrong key", signer: rsaKey(t)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kid, signer, nonce := "k1", crypto.Signer(key), "n1"
+			if tt.kid != "" {
+				kid = tt.kid
+			}
+			if tt.signer != nil {
+				signer = tt.signer
+			}
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+
+			c := idp.claims("n1")
+			if tt.modify != nil {
+				tt.modify(c)
+			}
+			if _, err := p.VerifyIDToken(context.Background(), sign(t, kid, signer, c), nonce); err == nil {
+				t.Error("VerifyIDToken accepted the token")
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenRequiresNonce(t *testing.T) {
+	idp := newFakeIdP(t)
+	key := rsaKey(t)
+	idp.addKey("k1", key)
+	p := discover(t, idp)
+
+	c := idp.claims("")
+	delete(c, "nonce")
+	if _, err := p.VerifyIDToken(context.Background(), sign(t, "k1", key, c), ""); err == nil {
+		t.Fatal("VerifyIDToken accepted a token without a nonce")
+	}
+}
+
+func TestVerifyIDTokenRejectsHMAC(t *testing.T) {
+	idp := newFakeIdP(t)
+	idp.addKey("k1", rsaKey(t))
+	p := discover(t, idp)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, idp.claims("n1"))
+	token.Header["kid"] = "k1"
+	raw, _ := token.SignedString([]byte(testClientSecret))
+	if _, err := p.VerifyIDToken(context.Background(), raw, "n1"); err == nil {
+		t.Fatal("VerifyIDToken accepted an HS256 token")
+	}
+}
+
+func TestVerifyIDTokenKeyRotation(t *testing.T) {
+	idp := newFakeIdP(t)
+	oldKey, newKey := rsaKey(t), ecKey(t)
+	idp.addKey("old", oldKey)
+	p := discover(t, idp)
+
+	if _, err := p.VerifyIDToken(context.Background(), sign(t, "old", oldKey, idp.claims("n1")), "n1"); err != nil {
+		t.Fatalf("old key: %v", err)
+	}
+
+	// the provider rotates; a token with the new kid shortly after the last
+	// fetch doesn't make us hammer the JWKS endpoint
+	idp.addKey("new", newKey)
+	idp.removeKey("old")
+	newToken := sign(t, "new", newKey, idp.claims("n1"))
+	hits := idp.hits()
+	if _, err := p.VerifyIDToken(context.Background(), newToken, "n1"); err == nil {
+		t.Fatal("new key accepted before the refresh interval passed")
+	}
+	if idp.hits() != hits {
+		t.Errorf("JWKS fetched %d more time(s) within the refresh interval", idp.hits()-hits)
+	}
+
+	// once the interval has passed, the unknown kid triggers a refetch
+	p.keys.mu.Lock()
+	p.keys.fetchedAt = time.Now().Add(-2 * jwksRefreshInterval)
+	p.keys.mu.Unlock()
+
+	if _, err := p.VerifyIDToken(context.Background(), newToken, "n1"); err != nil {
+		t.Fatalf("new key after refresh: %v", err)
+	}
+	if _, err := p.VerifyIDToken(context.Background(), sign(t, "old", oldKey, idp.claims("n1")), "n1"); err == nil {
+		t.Error("retired key still accepted after the refresh")
+	}
+}
@@ -0,0 +1,344 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"url-shortener/internal/config"
+	"url-shortener/internal/mail"
+	"url-shortener/internal/middleware"
+	"url-shortener/internal/models"
+	"url-shortener/internal/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// reauthMaxAge is how recent a provider sign-in has to be to confirm a
+// sensitive change on an account without a password.
+const reauthMaxAge = 5 * time.Minute
+
+// ChangePassword replaces the password after checking the current one, or
+// sets a first password on an account that signs in through a provider (see
+// confirmIdentity). Every other session is signed out; the caller gets a
+// fresh token pair.
+func ChangePassword(c *gin.Context) {
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+		Code            string `json:"code"`
+		NewPassword     string `json:"new_password" validate:"required,min=6"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !confirmIdentity(c, user, input.CurrentPassword, input.Code) {
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError("failed to hash password"))
+		return
+	}
+
+	if err := config.DB.Model(&user).Update("password", string(hashedPassword)).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	if err := middleware.RevokeUserTokens(user.ID); err != nil {
+		logrus.WithError(err).WithField("user_id", user.ID).Error("Failed to revoke tokens after password change")
+	}
+
+	respondWithTokens(c, user.ID, nil)
+}
+
+// ChangeEmail starts an email change. The new address only replaces the old
+// one once it is confirmed through the link mailed to it.
+func ChangeEmail(c *gin.Context) {
+	var input struct {
+		Email    string `json:"email" validate:"required,email"`
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !confirmIdentity(c, user, input.Password, input.Code) {
+		return
+	}
+
+	email := strings.TrimSpace(input.Email)
+	if email == user.Email {
+		c.JSON(http.StatusBadRequest, util.ResponseError("that is already your email"))
+		return
+	}
+
+	var existing models.User
+	if err := config.DB.Where("email = ?", email).First(&existing).Error; err == nil {
+		c.JSON(http.StatusConflict, util.ResponseError("email already registered"))
+		return
+	}
+
+	if err := config.DB.Model(&user).Update("pending_email", email).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	raw, err := issueEmailChangeToken(user.ID, email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	link := os.Getenv("SERVER_URL") + "/user/verify?token=" + url.QueryEscape(raw)
+	body := fmt.Sprintf("Hi %s,\n\nConfirm that you want to use this address for your account by opening this link:\n\n%s\n\nThe link expires in 48 hours.", user.Name, link)
+	if err := mail.Client.Send(email, "Confirm your new email address", body); err != nil {
+		logrus.WithError(err).WithField("user_id", user.ID).Error("Failed to send email change confirmation")
+		c.JSON(http.StatusInternalServerError, util.ResponseError("failed to send confirmation email"))
+		return
+	}
+
+	c.JSON(http.StatusAccepted, util.ResponseSuccess(gin.H{
+		"message":       "confirmation email sent to the new address",
+		"pending_email": email,
+	}))
+}
+
+// DeleteAccount removes the user. Their links are either deleted or handed
+// to another account ("links": "delete" or "transfer" with "transfer_to");
+// click data of the links is purged in both cases. Links can only go to
+// someone the user shares a workspace with, so nobody is handed links they
+// never agreed to take.
+func DeleteAccount(c *gin.Context) {
+	var input struct {
+		Password   string `json:"password"`
+		Code       string `json:"code"`
+		Links      string `json:"links" validate:"required,oneof=delete transfer"`
+		TransferTo string `json:"transfer_to" validate:"required_if=Links transfer,omitempty,email"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !confirmIdentity(c, user, input.Password, input.Code) {
+		return
+	}
+
+	var recipient models.User
+	if input.Links == "transfer" {
+		if err := config.DB.Where("email = ?", strings.TrimSpace(input.TransferTo)).First(&recipient).Error; err != nil {
+			c.JSON(http.StatusNotFound, util.ResponseError("transfer recipient not found"))
+			return
+		}
+		if recipient.ID == user.ID {
+			c.JSON(http.StatusBadRequest, util.ResponseError("cannot transfer links to yourself"))
+			return
+		}
+		if !shareWorkspace(user.ID, recipient.ID) {
+			c.JSON(http.StatusForbidden, util.ResponseErrorMeta("links can only be transferred to a member of one of your workspaces", gin.H{
+				"reason": "recipient_not_in_workspace",
+			}))
+			return
+		}
+	}
+
+	if owned := soleOwnedWorkspaces(user.ID); len(owned) > 0 {
+		c.JSON(http.StatusConflict, util.ResponseErrorMeta("make someone else an owner of your shared workspaces first", gin.H{
+			"reason":        "sole_workspace_owner",
+			"workspace_ids": owned,
+		}))
+		return
+	}
+
+	// revoke first: the user row the DB fallback reads is about to go
+	if err := middleware.RevokeUserTokens(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError("failed to revoke tokens"))
+		return
+	}
+
+	var moved int64
+	var deletedCodes []string
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := releaseWorkspaces(tx, user.ID); err != nil {
+			return err
+		}
+
+		urlIDs := tx.Unscoped().Model(&models.URL{}).Select("id").Where("user_id = ?", user.ID)
+
+		if err := tx.Unscoped().Where("url_id IN (?)", urlIDs).Delete(&models.Click{}).Error; err != nil {
+			return err
+		}
+
+		if input.Links == "transfer" {
+			result := tx.Model(&models.URL{}).Where("user_id = ?", user.ID).Update("user_id", recipient.ID)
+			if result.Error != nil {
+				return result.Error
+			}
+			moved = result.RowsAffected
+		}
+
+		if err := tx.Where("url_id IN (?)", urlIDs).Delete(&models.URLVersion{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.URL{}).Where("user_id = ?", user.ID).
+			Pluck("short_code", &deletedCodes).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.URL{}).Error; err != nil {
+			return err
+		}
+
+		return deleteUserData(tx, user.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	for _, code := range deletedCodes {
+		evictURL(c, code)
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
+		"message":           "account deleted",
+		"links_transferred": moved,
+	}))
+}
+
+// deleteUserData hard-deletes the user row and everything hanging off it,
+// freeing the email address for a new account.
+func deleteUserData(tx *gorm.DB, userID uint) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.UserToken{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RefreshToken{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&models.APIKey{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&models.UserIdentity{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&models.WorkspaceMember{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Delete(&models.User{}, userID).Error
+}
+
+// passwordMatches checks a password confirmation. Accounts without a password
+// never match.
+func passwordMatches(user models.User, password string) bool {
+	if user.Password == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) == nil
+}
+
+// confirmIdentity makes the caller prove again who they are before a
+// sensitive change, so a stolen access token alone isn't enough. Accounts
+// with a password confirm with it. Accounts that sign in through a provider
+// confirm with a TOTP code, or by having signed in within reauthMaxAge. It
+// writes the error response itself.
+func confirmIdentity(c *gin.Context, user models.User, password, code string) bool {
+	if user.Password != "" {
+		if passwordMatches(user, password) {
+			return true
+		}
+		c.JSON(http.StatusUnauthorized, util.ResponseError("password is incorrect"))
+		return false
+	}
+
+	if code != "" && user.TOTPEnabledAt != nil {
+		if verifySecondFactor(user, code, "") {
+			return true
+		}
+		c.JSON(http.StatusUnauthorized, util.ResponseError("invalid code"))
+		return false
+	}
+
+	if claims, ok := util.GetTokenClaims(c); ok {
+		if authTime, ok := claims["auth_time"].(float64); ok &&
+			time.Since(time.Unix(int64(authTime), 0)) <= reauthMaxAge {
+			return true
+		}
+	}
+
+	c.JSON(http.StatusForbidden, util.ResponseErrorMeta("sign in again to confirm this change", gin.H{
+		"reason":  "reauthentication_required",
+		"max_age": int(reauthMaxAge.Seconds()),
+	}))
+	return false
+}
+
+// currentUser loads the authenticated user. It writes the error response
+// itself.
+func currentUser(c *gin.Context) (models.User, bool) {
+	var user models.User
+
+	userID, ok := util.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, util.ResponseError("invalid token"))
+		return user, false
+	}
+
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, util.ResponseError("user not found"))
+			return user, false
+		}
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return user, false
+	}
+
+	return user, true
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"url-shortener/internal/config"
+	"url-shortener/internal/mail"
+	"url-shortener/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// linkSender keeps the token of the last link mailed to each address.
+type linkSender map[string]string
+
+func (s linkSender) Send(to, subject, body string) error {
+	link := body[strings.Index(body, "http"):]
+	link = link[:strings.IndexByte(link, '\n')]
+	u, err := url.Parse(link)
+	if err != nil {
+		return err
+	}
+	s[to] = u.Query().Get("token")
+	return nil
+}
+
+func useLinkSender(t *testing.T) linkSender {
+	t.Helper()
+	sender := linkSender{}
+	prev := mail.Client
+	mail.Client = sender
+	t.Cleanup(func() { mail.Client = prev })
+	return sender
+}
+
+func callHandler(t *testing.T, handler gin.HandlerFunc, userID uint, body string) (int, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	if userID != 0 {
+		c.Set("user_id", userID)
+	}
+
+	handler(c)
+
+	var resp models.APIResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp.Message
+}
+
+func TestChangeEmailOnlyLatestLinkConfirms(t *testing.T) {
+	useTestDB(t)
+	sender := useLinkSender(t)
+	t.Setenv("SERVER_URL", "https://short.example")
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret-pass"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := createUser(t, models.User{Email: "jane@example.com", Name: "Jane", Password: string(hash)})
+
+	for _, email := range []string{"a@example.com", "b@example.com"} {
+		body := `{"email":"` + email + `","password":"secret-pass"}`
+		if status, message := callHandler(t, ChangeEmail, user.ID, body); status != http.StatusAccepted {
+			t.Fatalf("change to %s = %d %q", email, status, message)
+		}
+	}
+
+	// the link mailed to a is stale once b has been requested
+	status, _ := callHandler(t, VerifyEmail, 0, `{"token":"`+sender["a@example.com"]+`"}`)
+	if status != http.StatusBadRequest {
+		t.Errorf("confirm with a's link = %d, want 400", status)
+	}
+	var reloaded models.User
+	config.DB.First(&reloaded, user.ID)
+	if reloaded.Email != "jane@example.com" {
+		t.Fatalf("email changed to %s through a's link", reloaded.Email)
+	}
+
+	status, message := callHandler(t, VerifyEmail, 0, `{"token":"`+sender["b@example.com"]+`"}`)
+	if status != http.StatusOK {
+		t.Fatalf("confirm with b's link = %d %q, want 200", status, message)
+	}
+	config.DB.First(&reloaded, user.ID)
+	if reloaded.Email != "b@example.com" || reloaded.PendingEmail != "" {
+		t.Errorf("email = %s, pending = %q; want b@example.com and none pending", reloaded.Email, reloaded.PendingEmail)
+	}
+}
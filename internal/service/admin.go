@@ -0,0 +1,341 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"url-shortener/internal/config"
+	"url-shortener/internal/middleware"
+	"url-shortener/internal/models"
+	"url-shortener/internal/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const maxAdminPageSize = 100
+
+// SeedAdmins gives the admin role to the accounts listed in ADMIN_EMAILS
+// (comma-separated), so a fresh install has someone to manage it. Accounts
+// are only ever promoted here; demote them through the admin API.
+func SeedAdmins() {
+	var emails []string
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			emails = append(emails, email)
+		}
+	}
+	if len(emails) == 0 {
+		return
+	}
+
+	result := config.DB.Model(&models.User{}).
+		Where("LOWER(email) IN ? AND role <> ?", emails, models.RoleAdmin).
+		Update("role", models.RoleAdmin)
+	if result.Error != nil {
+		log.Println("Failed to seed admins:", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Promoted %d account(s) from ADMIN_EMAILS to admin", result.RowsAffected)
+	}
+}
+
+// AdminListUsers pages through accounts, newest first. q searches email and
+// name.
+func AdminListUsers(c *gin.Context) {
+	page, limit := adminPage(c)
+
+	query := config.DB.Model(&models.User{})
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		pattern := likePattern(q)
+		query = query.Where("LOWER(email) LIKE ? OR LOWER(name) LIKE ?", pattern, pattern)
+	}
+
+	var total int64
+	query.Session(&gorm.Session{}).Count(&total)
+
+	var users []models.User
+	if err := query.Order("created_at DESC").Limit(limit).Offset((page - 1) * limit).
+		Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	items := make([]models.UserItem, 0, len(users))
+	for _, u := range users {
+		items = append(items, newUserItem(u))
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
+		"users": items,
+		"meta": gin.H{
+			"page":  page,
+			"limit": limit,
+			"count": len(items),
+			"total": total,
+		},
+	}))
+}
+
+func AdminGetUser(c *gin.Context) {
+	user, ok := adminTargetUser(c)
+	if !ok {
+		return
+	}
+
+	var links int64
+	config.DB.Model(&models.URL{}).Where("user_id = ?", user.ID).Count(&links)
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
+		"user":  newUserItem(user),
+		"links": links,
+	}))
+}
+
+// AdminDisableUser blocks an account: it can no longer sign in, refresh or
+// use its API keys, and every token it holds is revoked. Its links keep
+// working; disable those separately if needed.
+func AdminDisableUser(c *gin.Context) {
+	user, ok := adminTargetUser(c)
+	if !ok {
+		return
+	}
+
+	if adminID, _ := util.GetUserID(c); adminID == user.ID {
+		c.JSON(http.StatusBadRequest, util.ResponseError("you can't disable your own account"))
+		return
+	}
+
+	if user.DisabledAt == nil {
+		now := time.Now()
+		if err := config.DB.Model(&user).Update("disabled_at", now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+			return
+		}
+		user.DisabledAt = &now
+	}
+
+	if err := middleware.RevokeUserTokens(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError("failed to revoke tokens"))
+		return
+	}
+
+	logAdminAction(c, "user_disabled", logrus.Fields{"target_user_id": user.ID})
+	c.JSON(http.StatusOK, util.ResponseSuccess(newUserItem(user)))
+}
+
+func AdminEnableUser(c *gin.Context) {
+	user, ok := adminTargetUser(c)
+	if !ok {
+		return
+	}
+
+	if err := config.DB.Model(&user).Update("disabled_at", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+	user.DisabledAt = nil
+
+	logAdminAction(c, "user_enabled", logrus.Fields{"target_user_id": user.ID})
+	c.JSON(http.StatusOK, util.ResponseSuccess(newUserItem(user)))
+}
+
+// AdminUpdateUserRole grants or takes away the admin role. Admins can't
+// demote themselves, so there is always at least one left.
+func AdminUpdateUserRole(c *gin.Context) {
+	var input struct {
+		Role string `json:"role" binding:"required,oneof=user admin"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+
+	user, ok := adminTargetUser(c)
+	if !ok {
+		return
+	}
+
+	if adminID, _ := util.GetUserID(c); adminID == user.ID && input.Role != models.RoleAdmin {
+		c.JSON(http.StatusBadRequest, util.ResponseError("you can't remove your own admin role"))
+		return
+	}
+
+	if err := config.DB.Model(&user).Update("role", input.Role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+	user.Role = input.Role
+
+	logAdminAction(c, "user_role_changed", logrus.Fields{"target_user_id": user.ID, "role": input.Role})
+	c.JSON(http.StatusOK, util.ResponseSuccess(newUserItem(user)))
+}
+
+// AdminListURLs pages through every link, newest first. q searches the short
+// code and destination; user_id narrows it to one account.
+func AdminListURLs(c *gin.Context) {
+	page, limit := adminPage(c)
+
+	query := config.DB.Model(&models.URL{})
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		pattern := likePattern(q)
+		query = query.Where("LOWER(short_code) LIKE ? OR LOWER(original_url) LIKE ?", pattern, pattern)
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", util.ParseInt(userID))
+	}
+
+	var total int64
+	query.Session(&gorm.Session{}).Count(&total)
+
+	var urls []models.URL
+	if err := query.Order("created_at DESC").Limit(limit).Offset((page - 1) * limit).
+		Find(&urls).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	items := make([]models.AdminURLItem, 0, len(urls))
+	for _, u := range urls {
+		items = append(items, newAdminURLItem(u))
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
+		"urls": items,
+		"meta": gin.H{
+			"page":  page,
+			"limit": limit,
+			"count": len(items),
+			"total": total,
+		},
+	}))
+}
+
+func AdminGetURL(c *gin.Context) {
+	url, ok := adminTargetURL(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, util.ResponseSuccess(newAdminURLItem(url)))
+}
+
+// AdminDisableURL takes a link down, e.g. for abuse. Visitors get a 410 and
+// its owner can't turn it back on.
+func AdminDisableURL(c *gin.Context) {
+	url, ok := adminTargetURL(c)
+	if !ok {
+		return
+	}
+
+	if url.DisabledAt == nil {
+		now := time.Now()
+		if err := config.DB.Model(&url).Update("disabled_at", now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+			return
+		}
+		url.DisabledAt = &now
+	}
+	evictURL(c, url.ShortCode)
+
+	logAdminAction(c, "url_disabled", logrus.Fields{"short_code": url.ShortCode})
+	c.JSON(http.StatusOK, util.ResponseSuccess(newAdminURLItem(url)))
+}
+
+func AdminEnableURL(c *gin.Context) {
+	url, ok := adminTargetURL(c)
+	if !ok {
+		return
+	}
+
+	if err := config.DB.Model(&url).Update("disabled_at", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+	url.DisabledAt = nil
+
+	logAdminAction(c, "url_enabled", logrus.Fields{"short_code": url.ShortCode})
+	c.JSON(http.StatusOK, util.ResponseSuccess(newAdminURLItem(url)))
+}
+
+// adminTargetUser loads the account named by the :id param. It writes the
+// error response itself.
+func adminTargetUser(c *gin.Context) (models.User, bool) {
+	var user models.User
+	if err := config.DB.First(&user, util.ParseInt(c.Param("id"))).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, util.ResponseError("user not found"))
+			return user, false
+		}
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return user, false
+	}
+	return user, true
+}
+
+// adminTargetURL loads any link by the :code param. It writes the error
+// response itself.
+func adminTargetURL(c *gin.Context) (models.URL, bool) {
+	var url models.URL
+	if err := config.DB.Where("short_code = ?", c.Param("code")).First(&url).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, util.ResponseError("URL not found"))
+			return url, false
+		}
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return url, false
+	}
+	return url, true
+}
+
+func adminPage(c *gin.Context) (page, limit int) {
+	page = util.ParseInt(c.DefaultQuery("page", "1"))
+	limit = util.ParseInt(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > maxAdminPageSize {
+		limit = 20
+	}
+	return page, limit
+}
+
+// likePattern turns a search term into a case-insensitive LIKE pattern,
+// escaping the wildcards it may contain.
+func likePattern(q string) string {
+	q = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(q))
+	return "%" + q + "%"
+}
+
+func logAdminAction(c *gin.Context, action string, fields logrus.Fields) {
+	adminID, _ := util.GetUserID(c)
+	fields["action"] = action
+	fields["admin_user_id"] = adminID
+	fields["client_ip"] = c.ClientIP()
+	logrus.WithFields(fields).Info("Admin action")
+}
+
+func newUserItem(u models.User) models.UserItem {
+	return models.UserItem{
+		ID:              u.ID,
+		Email:           u.Email,
+		Name:            u.Name,
+		Role:            u.Role,
+		EmailVerifiedAt: u.EmailVerifiedAt,
+		TOTPEnabled:     u.TOTPEnabledAt != nil,
+		DisabledAt:      u.DisabledAt,
+		CreatedAt:       u.CreatedAt,
+	}
+}
+
+func newAdminURLItem(u models.URL) models.AdminURLItem {
+	return models.AdminURLItem{
+		HistoryItem: newHistoryItem(u),
+		UserID:      u.UserID,
+		SessionID:   u.SessionID,
+	}
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"url-shortener/internal/config"
+	"url-shortener/internal/models"
+	"url-shortener/internal/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+const apiKeyPrefix = "usk_"
+
+// CreateAPIKey issues a personal API key. The key itself is only returned by
+// this call.
+func CreateAPIKey(c *gin.Context) {
+	var input struct {
+		Name   string   `json:"name" validate:"required,max=100"`
+		Scopes []string `json:"scopes" validate:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+
+	for _, scope := range input.Scopes {
+		if !slices.Contains(models.APIKeyScopes, scope) {
+			c.JSON(http.StatusBadRequest, util.ResponseError("unknown scope "+scope))
+			return
+		}
+	}
+
+	userID, ok := util.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, util.ResponseError("invalid token"))
+		return
+	}
+
+	raw := apiKeyPrefix + util.GenerateSecureToken()
+	slices.Sort(input.Scopes)
+	key := models.APIKey{
+		UserID:  userID,
+		Name:    input.Name,
+		Prefix:  raw[:len(apiKeyPrefix)+8],
+		KeyHash: util.HashToken(raw),
+		Scopes:  strings.Join(slices.Compact(input.Scopes), " "),
+	}
+	if err := config.DB.Create(&key).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusCreated, util.ResponseSuccess(gin.H{
+		"key":     raw,
+		"api_key": newAPIKeyItem(key),
+	}))
+}
+
+func ListAPIKeys(c *gin.Context) {
+	userID, ok := util.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, util.ResponseError("invalid token"))
+		return
+	}
+
+	var keys []models.APIKey
+	if err := config.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	items := make([]models.APIKeyItem, 0, len(keys))
+	for _, k := range keys {
+		items = append(items, newAPIKeyItem(k))
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(items))
+}
+
+func RevokeAPIKey(c *gin.Context) {
+	userID, ok := util.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, util.ResponseError("invalid token"))
+		return
+	}
+
+	var key models.APIKey
+	if err := config.DB.Where("id = ? AND user_id = ?", util.ParseInt(c.Param("id")), userID).
+		First(&key).Error; err != nil {
+		c.JSON(http.StatusNotFound, util.ResponseError("API key not found"))
+		return
+	}
+
+	if key.RevokedAt == nil {
+		if err := config.DB.Model(&key).Update("revoked_at", time.Now()).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
+		"message": "API key revoked",
+	}))
+}
+
+func newAPIKeyItem(k models.APIKey) models.APIKeyItem {
+	return models.APIKeyItem{
+		ID:         k.ID,
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		Scopes:     k.ScopeList(),
+		LastUsedAt: k.LastUsedAt,
+		RevokedAt:  k.RevokedAt,
+		CreatedAt:  k.CreatedAt,
+	}
+}
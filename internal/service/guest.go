@@ -0,0 +1,104 @@
+package service
+
+import (
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+	"url-shortener/internal/config"
+	"url-shortener/internal/models"
+	"url-shortener/internal/util"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Guest links are limited per session and per client IP, both per rolling
+// day and in total. A limit of 0 turns that check off. Daily counts include
+// deleted links, so deleting doesn't buy more; totals only count live ones.
+// IPv6 clients are counted per /64 (see util.ClientNetwork).
+
+const (
+	guestQuotaWindow       = 24 * time.Hour
+	defaultGuestLinkExpiry = "30d"
+)
+
+type guestQuota struct {
+	scope  string // "session" or "ip"
+	period string // "day" or "total"
+	limit  int
+	query  func(tx *gorm.DB) *gorm.DB
+}
+
+// checkGuestQuota rejects a guest shorten request that would go over one of
+// the limits. It writes the 429 itself.
+func checkGuestQuota(c *gin.Context, sessionID uint) bool {
+	ip := util.ClientNetwork(c)
+	bySession := func(tx *gorm.DB) *gorm.DB { return tx.Where("session_id = ?", sessionID) }
+	byIP := func(tx *gorm.DB) *gorm.DB { return tx.Where("creator_ip = ? AND user_id IS NULL", ip) }
+
+	quotas := []guestQuota{
+		{"session", "day", config.GetEnvInt("GUEST_LINKS_PER_DAY", 20), bySession},
+		{"session", "total", config.GetEnvInt("GUEST_LINKS_TOTAL", 100), bySession},
+		{"ip", "day", config.GetEnvInt("GUEST_IP_LINKS_PER_DAY", 50), byIP},
+		{"ip", "total", config.GetEnvInt("GUEST_IP_LINKS_TOTAL", 500), byIP},
+	}
+
+	since := time.Now().Add(-guestQuotaWindow)
+	for _, quota := range quotas {
+		if quota.limit <= 0 {
+			continue
+		}
+
+		query := quota.query(config.DB.Model(&models.URL{}))
+		if quota.period == "day" {
+			query = query.Unscoped().Where("created_at > ?", since)
+		}
+		var count int64
+		if err := query.Count(&count).Error; err != nil || count < int64(quota.limit) {
+			continue
+		}
+
+		meta := gin.H{
+			"reason": "guest_quota_exceeded",
+			"scope":  quota.scope,
+			"period": quota.period,
+			"limit":  quota.limit,
+		}
+		if quota.period == "day" {
+			// a slot frees up once the oldest link in the window ages out
+			var oldest time.Time
+			quota.query(config.DB.Model(&models.URL{})).Unscoped().
+				Where("created_at > ?", since).
+				Select("MIN(created_at)").Scan(&oldest)
+			retryAfter := int(math.Ceil(time.Until(oldest.Add(guestQuotaWindow)).Seconds()))
+			if retryAfter > 0 {
+				c.Header("Retry-After", strconv.Itoa(retryAfter))
+				meta["retry_after"] = retryAfter
+			}
+		}
+		c.JSON(http.StatusTooManyRequests, util.ResponseErrorMeta("guest link limit reached, sign up to create more links", meta))
+		return false
+	}
+	return true
+}
+
+// guestLinkExpiry is when a guest link expires if it didn't ask for an
+// expiry. GUEST_LINK_EXPIRY takes durations like "30d" or "12h"; "0" keeps
+// guest links forever.
+func guestLinkExpiry() (*time.Time, error) {
+	raw := os.Getenv("GUEST_LINK_EXPIRY")
+	if raw == "" {
+		raw = defaultGuestLinkExpiry
+	}
+	if raw == "0" {
+		return nil, nil
+	}
+	d, err := util.ParseDuration(raw)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(d)
+	return &expiresAt, nil
+}
@@ -0,0 +1,16 @@
+package service
+
+import (
+	"net/http"
+	"url-shortener/internal/tokens"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWKS publishes the public keys access tokens are signed with, so other
+// services can verify them. It is a plain JWK set rather than an APIResponse
+// because JWT libraries read it as is.
+func JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": tokens.JWKS()})
+}
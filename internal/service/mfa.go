@@ -0,0 +1,290 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"url-shortener/internal/config"
+	"url-shortener/internal/middleware"
+	"url-shortener/internal/models"
+	"url-shortener/internal/tokens"
+	"url-shortener/internal/totp"
+	"url-shortener/internal/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	mfaChallengeTTL   = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+// completeLogin finishes a successful first factor. Accounts with 2FA get a
+// short-lived challenge token to redeem at /user/login/mfa instead of tokens;
+// it carries the guest session token along for the claim after the second
+// step.
+func completeLogin(c *gin.Context, user models.User) {
+	if !checkAccountEnabled(c, user) {
+		return
+	}
+
+	if user.TOTPEnabledAt == nil {
+		signIn(c, user.ID)
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"user_id": user.ID,
+	}
+	if sessionToken := middleware.GuestSessionToken(c); sessionToken != "" {
+		claims["session_token"] = sessionToken
+	}
+	challenge, err := tokens.Issue(tokens.TypeMFA, claims, mfaChallengeTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError("failed to issue tokens"))
+		return
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
+		"mfa_required": true,
+		"mfa_token":    challenge,
+		"expires_in":   int(mfaChallengeTTL.Seconds()),
+	}))
+}
+
+// LoginMFA is the second login step: it trades an MFA challenge token and a
+// TOTP or recovery code for an access/refresh pair.
+func LoginMFA(c *gin.Context) {
+	var input struct {
+		MFAToken     string `json:"mfa_token" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+
+	claims, err := tokens.Parse(input.MFAToken, tokens.TypeMFA)
+	userID, _ := claims["user_id"].(float64)
+	if err != nil || userID == 0 {
+		c.JSON(http.StatusUnauthorized, util.ResponseError("invalid or expired MFA token"))
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, uint(userID)).Error; err != nil || user.TOTPEnabledAt == nil {
+		c.JSON(http.StatusUnauthorized, util.ResponseError("invalid or expired MFA token"))
+		return
+	}
+	if !checkAccountEnabled(c, user) {
+		return
+	}
+
+	// MFA codes count against the same limits as passwords
+	if !checkLoginAllowed(c, user.Email) {
+		return
+	}
+
+	if !verifySecondFactor(user, input.Code, input.RecoveryCode) {
+		recordLoginFailure(c, user.Email, &user)
+		c.JSON(http.StatusUnauthorized, util.ResponseError("invalid code"))
+		return
+	}
+
+	clearLoginFailures(c.Request.Context(), user.Email)
+	if sessionToken, _ := claims["session_token"].(string); sessionToken != "" {
+		c.Set("session_token", sessionToken)
+	}
+	signIn(c, user.ID)
+}
+
+// EnrollTOTP starts 2FA enrollment with a new secret. 2FA isn't enforced
+// until ConfirmTOTP proves the authenticator app has it.
+func EnrollTOTP(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.TOTPEnabledAt != nil {
+		c.JSON(http.StatusConflict, util.ResponseError("two-factor authentication is already enabled"))
+		return
+	}
+
+	secret := totp.GenerateSecret()
+	if err := config.DB.Model(&user).Update("totp_secret", secret).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "URL Shortener"
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
+		"secret":      secret,
+		"otpauth_uri": totp.URI(issuer, user.Email, secret),
+	}))
+}
+
+// ConfirmTOTP turns 2FA on once a code from the enrolled secret checks out,
+// and returns the recovery codes. They are only shown this once.
+func ConfirmTOTP(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.TOTPEnabledAt != nil {
+		c.JSON(http.StatusConflict, util.ResponseError("two-factor authentication is already enabled"))
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, util.ResponseError("start enrollment first"))
+		return
+	}
+
+	step, valid := totp.Validate(user.TOTPSecret, input.Code, time.Now())
+	if !valid {
+		c.JSON(http.StatusUnauthorized, util.ResponseError("invalid code"))
+		return
+	}
+
+	var codes []string
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_enabled_at": time.Now(),
+			"totp_last_step":  step,
+		}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
+		"message":        "two-factor authentication enabled",
+		"recovery_codes": codes,
+	}))
+}
+
+// DisableTOTP turns 2FA off. It asks for the password and a current code so a
+// stolen access token alone can't remove the second factor.
+func DisableTOTP(c *gin.Context) {
+	var input struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.TOTPEnabledAt == nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError("two-factor authentication is not enabled"))
+		return
+	}
+
+	// the code is what confirms accounts that have no password
+	passwordOK := user.Password == "" || passwordMatches(user, input.Password)
+	if !passwordOK || !verifySecondFactor(user, input.Code, input.RecoveryCode) {
+		c.JSON(http.StatusUnauthorized, util.ResponseError("invalid password or code"))
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_secret":     "",
+			"totp_enabled_at": nil,
+			"totp_last_step":  0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
+		"message": "two-factor authentication disabled",
+	}))
+}
+
+// verifySecondFactor accepts a TOTP code, each time step at most once, or
+// an unused recovery code.
+func verifySecondFactor(user models.User, code, recoveryCode string) bool {
+	if code != "" {
+		step, ok := totp.Validate(user.TOTPSecret, code, time.Now())
+		if !ok {
+			return false
+		}
+		result := config.DB.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		return result.Error == nil && result.RowsAffected == 1
+	}
+
+	if recoveryCode != "" {
+		hash := util.HashToken(normalizeRecoveryCode(recoveryCode))
+		result := config.DB.Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hash).
+			Update("used_at", time.Now())
+		return result.Error == nil && result.RowsAffected == 1
+	}
+
+	return false
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		rand.Read(b)
+		code := hex.EncodeToString(b)
+		codes = append(codes, code[:5]+"-"+code[5:])
+		records = append(records, models.RecoveryCode{UserID: userID, CodeHash: util.HashToken(code)})
+	}
+
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
@@ -0,0 +1,268 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"url-shortener/internal/config"
+	"url-shortener/internal/middleware"
+	"url-shortener/internal/models"
+	"url-shortener/internal/oidc"
+	"url-shortener/internal/tokens"
+	"url-shortener/internal/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcStateTTL    = 10 * time.Minute
+)
+
+var (
+	oidcMu       sync.Mutex
+	oidcProvider *oidc.Provider
+)
+
+// getOIDCProvider discovers the provider configured by OIDC_ISSUER on first
+// use. A failed discovery is retried on the next request.
+func getOIDCProvider(ctx context.Context) (*oidc.Provider, error) {
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+
+	if oidcProvider != nil {
+		return oidcProvider, nil
+	}
+
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil, errors.New("OIDC login is not configured")
+	}
+
+	redirectURL := os.Getenv("OIDC_REDIRECT_URL")
+	if redirectURL == "" {
+		redirectURL = os.Getenv("SERVER_URL") + "/user/oidc/callback"
+	}
+
+	provider, err := oidc.Discover(ctx, issuer, os.Getenv("OIDC_CLIENT_ID"), os.Getenv("OIDC_CLIENT_SECRET"), redirectURL)
+	if err != nil {
+		return nil, err
+	}
+	oidcProvider = provider
+	return provider, nil
+}
+
+// OIDCLogin starts the authorization code flow. State, nonce and the PKCE
+// verifier travel in a short-lived signed cookie until the callback, and so
+// does the guest session token whose links the callback claims. A browser
+// navigating here can't send X-Session-Token, so it may pass the token as
+// ?session_token= instead.
+func OIDCLogin(c *gin.Context) {
+	provider, err := getOIDCProvider(c.Request.Context())
+	if err != nil {
+		logrus.WithError(err).Error("OIDC provider unavailable")
+		c.JSON(http.StatusServiceUnavailable, util.ResponseError("single sign-on is unavailable"))
+		return
+	}
+
+	state, nonce, verifier := util.GenerateSecureToken(), util.GenerateSecureToken(), oidc.NewVerifier()
+	claims := jwt.MapClaims{
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+	}
+	sessionToken := middleware.GuestSessionToken(c)
+	if sessionToken == "" {
+		sessionToken = c.Query("session_token")
+	}
+	if sessionToken != "" {
+		claims["session_token"] = sessionToken
+	}
+	cookie, err := tokens.Issue(tokens.TypeOIDCState, claims, oidcStateTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError("failed to start login"))
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, cookie, int(oidcStateTTL.Seconds()), "/", "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, provider.AuthCodeURL(state, nonce, oidc.Challenge(verifier)))
+}
+
+// OIDCCallback finishes the flow: it redeems the code, verifies the ID token
+// and signs in the linked account, linking or creating one by verified email
+// on first login.
+func OIDCCallback(c *gin.Context) {
+	if errCode := c.Query("error"); errCode != "" {
+		c.JSON(http.StatusUnauthorized, util.ResponseError("sign-in was not completed: "+errCode))
+		return
+	}
+
+	provider, err := getOIDCProvider(c.Request.Context())
+	if err != nil {
+		logrus.WithError(err).Error("OIDC provider unavailable")
+		c.JSON(http.StatusServiceUnavailable, util.ResponseError("single sign-on is unavailable"))
+		return
+	}
+
+	raw, _ := c.Cookie(oidcStateCookie)
+	c.SetCookie(oidcStateCookie, "", -1, "/", "", c.Request.TLS != nil, true)
+
+	state, err := tokens.Parse(raw, tokens.TypeOIDCState)
+	if err != nil || state["state"] != c.Query("state") {
+		c.JSON(http.StatusBadRequest, util.ResponseError("invalid or expired login state"))
+		return
+	}
+
+	nonce, _ := state["nonce"].(string)
+	verifier, _ := state["verifier"].(string)
+	if sessionToken, _ := state["session_token"].(string); sessionToken != "" {
+		c.Set("session_token", sessionToken)
+	}
+
+	idToken, err := provider.Exchange(c.Request.Context(), c.Query("code"), verifier)
+	if err != nil {
+		logrus.WithError(err).Warn("OIDC code exchange failed")
+		c.JSON(http.StatusUnauthorized, util.ResponseError("sign-in failed"))
+		return
+	}
+
+	claims, err := provider.VerifyIDToken(c.Request.Context(), idToken, nonce)
+	if err != nil {
+		logrus.WithError(err).Warn("OIDC ID token rejected")
+		c.JSON(http.StatusUnauthorized, util.ResponseError("sign-in failed"))
+		return
+	}
+
+	user, err := resolveOIDCUser(provider.Issuer, claims)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, util.ResponseError(err.Error()))
+		return
+	}
+
+	completeLogin(c, user)
+}
+
+// resolveOIDCUser finds the account for a provider login: the linked one,
+// else the account with the same verified email, else a new account.
+func resolveOIDCUser(issuer string, claims *oidc.Claims) (models.User, error) {
+	var user models.User
+	now := time.Now()
+
+	var identity models.UserIdentity
+	err := config.DB.Where("issuer = ? AND subject = ?", issuer, claims.Subject).First(&identity).Error
+	if err == nil {
+		config.DB.Model(&identity).Update("last_login_at", now)
+		if err := config.DB.First(&user, identity.UserID).Error; err != nil {
+			return user, errors.New("linked account not found")
+		}
+		return user, nil
+	}
+
+	email := strings.TrimSpace(claims.Email)
+	if email == "" || !claims.EmailVerified {
+		return user, errors.New("the provider did not supply a verified email")
+	}
+
+	var takenOver bool
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("email = ?", email).First(&user).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			name := claims.Name
+			if name == "" {
+				name = email
+			}
+			// no password: the account signs in through the provider
+			user = models.User{Email: email, Name: name, EmailVerifiedAt: &now}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		case user.EmailVerifiedAt == nil:
+			// Nobody proved ownership of this address locally, so whoever set
+			// the password may not own it. Drop the password and its sessions.
+			if err := tx.Model(&user).Updates(map[string]interface{}{
+				"password":          "",
+				"email_verified_at": now,
+			}).Error; err != nil {
+				return err
+			}
+			takenOver = true
+		}
+
+		return tx.Create(&models.UserIdentity{
+			UserID:      user.ID,
+			Issuer:      issuer,
+			Subject:     claims.Subject,
+			Email:       email,
+			LastLoginAt: &now,
+		}).Error
+	})
+	if err != nil {
+		return user, err
+	}
+
+	if takenOver {
+		if err := middleware.RevokeUserTokens(user.ID); err != nil {
+			return user, err
+		}
+	}
+	return user, nil
+}
+
+func ListIdentities(c *gin.Context) {
+	userID, ok := util.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, util.ResponseError("invalid token"))
+		return
+	}
+
+	var identities []models.UserIdentity
+	if err := config.DB.Where("user_id = ?", userID).Order("created_at").Find(&identities).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(identities))
+}
+
+// UnlinkIdentity disconnects a provider login. The last way to sign in can't
+// be removed from an account without a password.
+func UnlinkIdentity(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var identity models.UserIdentity
+	if err := config.DB.Where("id = ? AND user_id = ?", util.ParseInt(c.Param("id")), user.ID).
+		First(&identity).Error; err != nil {
+		c.JSON(http.StatusNotFound, util.ResponseError("identity not found"))
+		return
+	}
+
+	var count int64
+	config.DB.Model(&models.UserIdentity{}).Where("user_id = ?", user.ID).Count(&count)
+	if user.Password == "" && count <= 1 {
+		c.JSON(http.StatusConflict, util.ResponseError("set a password before unlinking your last sign-in method"))
+		return
+	}
+
+	if err := config.DB.Delete(&identity).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
+		"message": "identity unlinked",
+	}))
+}
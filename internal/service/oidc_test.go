@@ -0,0 +1,172 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+	"url-shortener/internal/config"
+	"url-shortener/internal/models"
+	"url-shortener/internal/oidc"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+const testIssuer = "https://idp.example"
+
+// useTestDB points config.DB at a fresh SQLite database for one test.
+func useTestDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		TranslateError: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.UserIdentity{}, &models.RefreshToken{}, &models.UserToken{}); err != nil {
+		t.Fatal(err)
+	}
+
+	prev := config.DB
+	config.DB = db
+	t.Cleanup(func() { config.DB = prev })
+}
+
+func createUser(t *testing.T, user models.User) models.User {
+	t.Helper()
+	if err := config.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func identityCount(t *testing.T, userID uint) int64 {
+	t.Helper()
+	var count int64
+	config.DB.Model(&models.UserIdentity{}).Where("user_id = ? AND issuer = ?", userID, testIssuer).Count(&count)
+	return count
+}
+
+func TestResolveOIDCUserAlreadyLinked(t *testing.T) {
+	useTestDB(t)
+	user := createUser(t, models.User{Email: "jane@example.com", Name: "Jane", Password: "hash"})
+	linked := models.UserIdentity{UserID: user.ID, Issuer: testIssuer, Subject: "sub-1", Email: user.Email}
+	if err := config.DB.Create(&linked).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// a linked login is found by subject, whatever the email now says
+	got, err := resolveOIDCUser(testIssuer, &oidc.Claims{Subject: "sub-1", Email: "changed@example.com"})
+	if err != nil {
+		t.Fatalf("resolveOIDCUser: %v", err)
+	}
+	if got.ID != user.ID {
+		t.Errorf("got user %d, want %d", got.ID, user.ID)
+	}
+
+	var identity models.UserIdentity
+	config.DB.First(&identity, linked.ID)
+	if identity.LastLoginAt == nil {
+		t.Error("last_login_at was not updated")
+	}
+}
+
+func TestResolveOIDCUserLinksVerifiedEmail(t *testing.T) {
+	useTestDB(t)
+	verifiedAt := time.Now().Add(-time.Hour)
+	user := createUser(t, models.User{Email: "jane@example.com", Name: "Jane", Password: "hash", EmailVerifiedAt: &verifiedAt})
+
+	got, err := resolveOIDCUser(testIssuer, &oidc.Claims{Subject: "sub-1", Email: "jane@example.com", EmailVerified: true})
+	if err != nil {
+		t.Fatalf("resolveOIDCUser: %v", err)
+	}
+	if got.ID != user.ID {
+		t.Errorf("got user %d, want %d", got.ID, user.ID)
+	}
+	if n := identityCount(t, user.ID); n != 1 {
+		t.Errorf("%d identities linked, want 1", n)
+	}
+
+	var reloaded models.User
+	config.DB.First(&reloaded, user.ID)
+	if reloaded.Password != "hash" {
+		t.Error("the password of a verified account was dropped")
+	}
+	if reloaded.TokensRevokedAt != nil {
+		t.Error("the sessions of a verified account were revoked")
+	}
+}
+
+func TestResolveOIDCUserTakesOverUnverifiedAccount(t *testing.T) {
+	useTestDB(t)
+	user := createUser(t, models.User{Email: "jane@example.com", Name: "Squatter", Password: "hash"})
+
+	got, err := resolveOIDCUser(testIssuer, &oidc.Claims{Subject: "sub-1", Email: "jane@example.com", EmailVerified: true})
+	if err != nil {
+		t.Fatalf("resolveOIDCUser: %v", err)
+	}
+	if got.ID != user.ID {
+		t.Errorf("got user %d, want %d", got.ID, user.ID)
+	}
+
+	// whoever set the password never proved they own the address
+	var reloaded models.User
+	config.DB.First(&reloaded, user.ID)
+	if reloaded.Password != "" {
+		t.Error("the password of an unverified account was kept")
+	}
+	if reloaded.EmailVerifiedAt == nil {
+		t.Error("the email was not marked verified")
+	}
+	if reloaded.TokensRevokedAt == nil {
+		t.Error("the existing sessions were not revoked")
+	}
+	if n := identityCount(t, user.ID); n != 1 {
+		t.Errorf("%d identities linked, want 1", n)
+	}
+}
+
+func TestResolveOIDCUserCreatesAccount(t *testing.T) {
+	useTestDB(t)
+
+	got, err := resolveOIDCUser(testIssuer, &oidc.Claims{Subject: "sub-1", Email: "new@example.com", EmailVerified: true, Name: "New"})
+	if err != nil {
+		t.Fatalf("resolveOIDCUser: %v", err)
+	}
+	if got.ID == 0 || got.Email != "new@example.com" || got.Name != "New" {
+		t.Errorf("got %+v, want a new account for new@example.com", got)
+	}
+	if got.Password != "" {
+		t.Error("a provider account got a password")
+	}
+	if got.EmailVerifiedAt == nil {
+		t.Error("the email was not marked verified")
+	}
+	if n := identityCount(t, got.ID); n != 1 {
+		t.Errorf("%d identities linked, want 1", n)
+	}
+
+	// the next login finds the same account through the identity
+	again, err := resolveOIDCUser(testIssuer, &oidc.Claims{Subject: "sub-1", Email: "new@example.com", EmailVerified: true})
+	if err != nil || again.ID != got.ID {
+		t.Errorf("second login = %d, %v; want %d", again.ID, err, got.ID)
+	}
+}
+
+func TestResolveOIDCUserRequiresVerifiedEmail(t *testing.T) {
+	useTestDB(t)
+	user := createUser(t, models.User{Email: "jane@example.com", Name: "Jane", Password: "hash"})
+
+	if _, err := resolveOIDCUser(testIssuer, &oidc.Claims{Subject: "sub-1", Email: "jane@example.com"}); err == nil {
+		t.Fatal("resolveOIDCUser accepted an unverified email")
+	}
+	if _, err := resolveOIDCUser(testIssuer, &oidc.Claims{Subject: "sub-2", EmailVerified: true}); err == nil {
+		t.Fatal("resolveOIDCUser accepted a login without an email")
+	}
+
+	var count int64
+	config.DB.Model(&models.User{}).Count(&count)
+	if count != 1 || identityCount(t, user.ID) != 0 {
+		t.Error("a rejected login changed accounts or identities")
+	}
+}
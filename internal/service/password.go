@@ -0,0 +1,121 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"url-shortener/internal/config"
+	"url-shortener/internal/mail"
+	"url-shortener/internal/middleware"
+	"url-shortener/internal/models"
+	"url-shortener/internal/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const passwordResetTTL = time.Hour
+
+// ForgotPassword mails a reset link when the address belongs to an account.
+// It answers the same way either way so it can't be used to find accounts.
+func ForgotPassword(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" validate:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+
+	var user models.User
+	if err := config.DB.Where("email = ?", strings.TrimSpace(input.Email)).First(&user).Error; err == nil {
+		// sent in the background so response time doesn't reveal the account
+		go sendPasswordResetEmail(user)
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
+		"message": "if the email belongs to an account, a reset link has been sent",
+	}))
+}
+
+// ResetPassword sets a new password from a reset token and signs the user
+// out everywhere.
+func ResetPassword(c *gin.Context) {
+	var input struct {
+		Token    string `json:"token" validate:"required"`
+		Password string `json:"password" validate:"required,min=6"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+
+	token, err := consumeUserToken(input.Token, models.TokenPurposePasswordReset)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(errInvalidToken.Error()))
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError("failed to hash password"))
+		return
+	}
+
+	if err := config.DB.Model(&models.User{}).
+		Where("id = ?", token.UserID).
+		Update("password", string(hashedPassword)).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	// any other outstanding reset links die with this one
+	config.DB.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", token.UserID, models.TokenPurposePasswordReset).
+		Update("used_at", time.Now())
+
+	if err := middleware.RevokeUserTokens(token.UserID); err != nil {
+		logrus.WithError(err).WithField("user_id", token.UserID).Error("Failed to revoke tokens after password reset")
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, token.UserID).Error; err == nil {
+		clearLoginFailures(c.Request.Context(), user.Email)
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
+		"message": "password has been reset",
+	}))
+}
+
+func sendPasswordResetEmail(user models.User) {
+	raw, err := issueUserToken(user.ID, models.TokenPurposePasswordReset, passwordResetTTL)
+	if err != nil {
+		logrus.WithError(err).WithField("user_id", user.ID).Error("Failed to issue password reset token")
+		return
+	}
+
+	link := os.Getenv("APP_URL") + "/reset-password?token=" + url.QueryEscape(raw)
+	body := fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your account. If it was you, open this link to choose a new one:\n\n%s\n\nThe link expires in one hour. If you didn't ask for this, you can ignore this email.", user.Name, link)
+
+	if err := mail.Client.Send(user.Email, "Reset your password", body); err != nil {
+		logrus.WithError(err).WithField("user_id", user.ID).Error("Failed to send password reset email")
+	}
+}
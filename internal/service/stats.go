@@ -0,0 +1,49 @@
+package service
+
+import (
+	"net/http"
+	"time"
+	"url-shortener/internal/config"
+	"url-shortener/internal/models"
+	"url-shortener/internal/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+const statsWindowDays = 30
+
+type dailyClicks struct {
+	Day    time.Time `json:"day"`
+	Clicks int64     `json:"clicks"`
+}
+
+// GetURLStats reports click analytics for a link the caller manages: totals
+// and a per-day breakdown of the last 30 days.
+func GetURLStats(c *gin.Context) {
+	url, ok := findOwnedURL(c)
+	if !ok {
+		return
+	}
+
+	var fallbackClicks int64
+	config.DB.Model(&models.Click{}).Where("url_id = ? AND fallback", url.ID).Count(&fallbackClicks)
+
+	since := time.Now().AddDate(0, 0, -statsWindowDays)
+	var daily []dailyClicks
+	if err := config.DB.Model(&models.Click{}).
+		Select("DATE(created_at) AS day, COUNT(*) AS clicks").
+		Where("url_id = ? AND created_at >= ?", url.ID, since).
+		Group("day").
+		Order("day").
+		Scan(&daily).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
+		"link":            newHistoryItem(url),
+		"clicks":          url.Clicks,
+		"fallback_clicks": fallbackClicks,
+		"daily":           daily,
+	}))
+}
@@ -0,0 +1,263 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"url-shortener/internal/config"
+	"url-shortener/internal/mail"
+	"url-shortener/internal/models"
+	"url-shortener/internal/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+)
+
+// Failed logins are counted per account and per client IP (per /64 for IPv6,
+// see util.ClientNetwork) in Redis. After a few failures each further attempt
+// has to wait progressively longer; past the limit the account or IP is
+// locked out for a while. Without Redis the checks fail open.
+
+const (
+	unlockAccountTTL  = 24 * time.Hour
+	loginFreeFailures = 3
+	loginMaxDelay     = time.Minute
+)
+
+type loginLimits struct {
+	accountMax int
+	ipMax      int
+	window     time.Duration
+	lockout    time.Duration
+}
+
+func getLoginLimits() loginLimits {
+	return loginLimits{
+		accountMax: config.GetEnvInt("LOGIN_MAX_ATTEMPTS", 10),
+		ipMax:      config.GetEnvInt("LOGIN_IP_MAX_ATTEMPTS", 50),
+		window:     time.Duration(config.GetEnvInt("LOGIN_ATTEMPT_WINDOW_MINUTES", 15)) * time.Minute,
+		lockout:    time.Duration(config.GetEnvInt("LOGIN_LOCKOUT_MINUTES", 15)) * time.Minute,
+	}
+}
+
+func loginAccountKey(kind, email string) string {
+	return "login:" + kind + ":acct:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func loginIPKey(kind, ip string) string {
+	return "login:" + kind + ":ip:" + ip
+}
+
+// checkLoginAllowed rejects attempts for a locked account or IP, or that come
+// before the progressive delay has passed. It writes the 429 itself.
+func checkLoginAllowed(c *gin.Context, email string) bool {
+	if config.RedisClient == nil {
+		return true
+	}
+	ctx := c.Request.Context()
+
+	checks := []struct {
+		key    string
+		reason string
+	}{
+		{loginIPKey("lock", util.ClientNetwork(c)), "ip_locked"},
+		{loginAccountKey("lock", email), "account_locked"},
+		{loginAccountKey("wait", email), "retry_later"},
+	}
+	for _, check := range checks {
+		ttl, err := config.RedisClient.TTL(ctx, check.key).Result()
+		if err != nil || ttl <= 0 {
+			continue
+		}
+
+		retryAfter := int(math.Ceil(ttl.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, util.ResponseErrorMeta("too many failed login attempts", gin.H{
+			"reason":      check.reason,
+			"retry_after": retryAfter,
+		}))
+		return false
+	}
+	return true
+}
+
+// recordLoginFailure counts a failed attempt and applies delays and lockouts.
+// user is nil when the email doesn't belong to an account.
+func recordLoginFailure(c *gin.Context, email string, user *models.User) {
+	if config.RedisClient == nil {
+		return
+	}
+	ctx := c.Request.Context()
+	limits := getLoginLimits()
+	ip := util.ClientNetwork(c)
+
+	ipFailures, err := incrWithin(ctx, loginIPKey("fail", ip), limits.window)
+	if err != nil {
+		logrus.WithError(err).Warn("Login throttling unavailable")
+		return
+	}
+	if limits.ipMax > 0 && ipFailures >= int64(limits.ipMax) {
+		config.RedisClient.Set(ctx, loginIPKey("lock", ip), 1, limits.lockout)
+		logSecurityEvent("ip_locked", logrus.Fields{"client_ip": ip, "failures": ipFailures})
+	}
+
+	accountFailures, err := incrWithin(ctx, loginAccountKey("fail", email), limits.window)
+	if err != nil {
+		return
+	}
+
+	if limits.accountMax > 0 && accountFailures >= int64(limits.accountMax) {
+		config.RedisClient.Set(ctx, loginAccountKey("lock", email), 1, limits.lockout)
+		fields := logrus.Fields{"email": email, "client_ip": ip, "failures": accountFailures}
+		// one unlock email per lockout window
+		if user != nil {
+			fields["user_id"] = user.ID
+			if accountFailures == int64(limits.accountMax) {
+				go sendUnlockEmail(*user, limits.lockout)
+			}
+		}
+		logSecurityEvent("account_locked", fields)
+		return
+	}
+
+	if accountFailures > loginFreeFailures {
+		delay := time.Duration(1<<min(accountFailures-loginFreeFailures-1, 6)) * time.Second
+		config.RedisClient.Set(ctx, loginAccountKey("wait", email), 1, min(delay, loginMaxDelay))
+	}
+}
+
+// clearLoginFailures resets an account's counters, delay and lockout.
+func clearLoginFailures(ctx context.Context, email string) {
+	if config.RedisClient == nil {
+		return
+	}
+	config.RedisClient.Del(ctx,
+		loginAccountKey("fail", email),
+		loginAccountKey("wait", email),
+		loginAccountKey("lock", email),
+	)
+}
+
+// UnlockAccount lifts a lockout with the token from the unlock email.
+func UnlockAccount(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" form:"token"`
+	}
+	c.ShouldBind(&input)
+	if input.Token == "" {
+		input.Token = c.Query("token")
+	}
+	if input.Token == "" {
+		c.JSON(http.StatusBadRequest, util.ResponseError("token is required"))
+		return
+	}
+
+	token, err := consumeUserToken(input.Token, models.TokenPurposeUnlockAccount)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(errInvalidToken.Error()))
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, token.UserID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(errInvalidToken.Error()))
+		return
+	}
+
+	clearLoginFailures(c.Request.Context(), user.Email)
+	logSecurityEvent("account_unlocked", logrus.Fields{"user_id": user.ID, "client_ip": c.ClientIP()})
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
+		"message": "account unlocked",
+	}))
+}
+
+func sendUnlockEmail(user models.User, lockout time.Duration) {
+	raw, err := issueUserToken(user.ID, models.TokenPurposeUnlockAccount, unlockAccountTTL)
+	if err != nil {
+		logrus.WithError(err).WithField("user_id", user.ID).Error("Failed to issue unlock token")
+		return
+	}
+
+	link := os.Getenv("SERVER_URL") + "/user/unlock?token=" + url.QueryEscape(raw)
+	body := fmt.Sprintf("Hi %s,\n\nYour account was locked for %d minutes after too many failed sign-in attempts. If that was you, you can unlock it right away:\n\n%s\n\nIf it wasn't you, consider changing your password.", user.Name, int(lockout.Minutes()), link)
+
+	if err := mail.Client.Send(user.Email, "Your account has been locked", body); err != nil {
+		logrus.WithError(err).WithField("user_id", user.ID).Error("Failed to send unlock email")
+	}
+}
+
+// Wrong link passwords are counted in Redis per link and client network
+// (see util.ClientNetwork), with the same counter as failed logins. Past
+// LINK_UNLOCK_MAX_ATTEMPTS within linkUnlockWindow that visitor is locked out
+// of the link for linkUnlockLockout; other visitors can still unlock it.
+
+const (
+	linkUnlockWindow  = 15 * time.Minute
+	linkUnlockLockout = 15 * time.Minute
+)
+
+func linkUnlockKey(kind string, url models.URL, network string) string {
+	return fmt.Sprintf("unlock:%s:%d:%s", kind, url.ID, network)
+}
+
+// linkUnlockRetryAfter is how long the caller has to wait before trying the
+// link's password again, or 0 if they may try now.
+func linkUnlockRetryAfter(c *gin.Context, url models.URL) time.Duration {
+	if config.RedisClient == nil {
+		return 0
+	}
+	ttl, err := config.RedisClient.TTL(c.Request.Context(), linkUnlockKey("lock", url, util.ClientNetwork(c))).Result()
+	if err != nil || ttl <= 0 {
+		return 0
+	}
+	return ttl
+}
+
+func recordLinkUnlockFailure(c *gin.Context, url models.URL) {
+	if config.RedisClient == nil {
+		return
+	}
+	ctx := c.Request.Context()
+	network := util.ClientNetwork(c)
+
+	failures, err := incrWithin(ctx, linkUnlockKey("fail", url, network), linkUnlockWindow)
+	if err != nil {
+		logrus.WithError(err).Warn("Link unlock throttling unavailable")
+		return
+	}
+	if limit := config.GetEnvInt("LINK_UNLOCK_MAX_ATTEMPTS", 5); limit > 0 && failures >= int64(limit) {
+		config.RedisClient.Set(ctx, linkUnlockKey("lock", url, network), 1, linkUnlockLockout)
+		logSecurityEvent("link_unlock_locked", logrus.Fields{"short_code": url.ShortCode, "client_ip": network, "failures": failures})
+	}
+}
+
+func clearLinkUnlockFailures(c *gin.Context, url models.URL) {
+	if config.RedisClient == nil {
+		return
+	}
+	config.RedisClient.Del(c.Request.Context(), linkUnlockKey("fail", url, util.ClientNetwork(c)))
+}
+
+// incrWithin increments a counter that resets window after its first hit.
+func incrWithin(ctx context.Context, key string, window time.Duration) (int64, error) {
+	pipe := config.RedisClient.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, window)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+func logSecurityEvent(event string, fields logrus.Fields) {
+	fields["event"] = event
+	logrus.WithFields(fields).Warn("Security event")
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"errors"
+	"time"
+	"url-shortener/internal/config"
+	"url-shortener/internal/models"
+	"url-shortener/internal/util"
+
+	"gorm.io/gorm"
+)
+
+var errInvalidToken = errors.New("invalid or expired token")
+
+// issueUserToken creates a single-use token for a user and returns the raw
+// value to mail out; only its hash is stored.
+func issueUserToken(userID uint, purpose string, ttl time.Duration) (string, error) {
+	raw := util.GenerateSecureToken()
+	token := models.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: util.HashToken(raw),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := config.DB.Create(&token).Error; err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// issueEmailChangeToken issues the change_email token for a new address. The
+// token remembers the address, and earlier unused ones are retired, so only
+// the link mailed to the latest pending address can confirm it.
+func issueEmailChangeToken(userID uint, email string) (string, error) {
+	raw := util.GenerateSecureToken()
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, models.TokenPurposeChangeEmail).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.UserToken{
+			UserID:    userID,
+			Purpose:   models.TokenPurposeChangeEmail,
+			TokenHash: util.HashToken(raw),
+			Email:     email,
+			ExpiresAt: time.Now().Add(verifyEmailTTL),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// consumeUserToken marks a token issued for one of purposes as used and
+// returns it. The conditional UPDATE makes sure a token can only be redeemed
+// once.
+func consumeUserToken(raw string, purposes ...string) (models.UserToken, error) {
+	var token models.UserToken
+	hash := util.HashToken(raw)
+
+	result := config.DB.Model(&models.UserToken{}).
+		Where("token_hash = ? AND purpose IN ? AND used_at IS NULL AND expires_at > ?", hash, purposes, time.Now()).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return token, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return token, errInvalidToken
+	}
+
+	err := config.DB.Where("token_hash = ?", hash).First(&token).Error
+	return token, err
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+	"url-shortener/internal/models"
+	"url-shortener/internal/tokens"
+	"url-shortener/internal/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	unlockTTL          = 15 * time.Minute
+	minLinkPasswordLen = 8
+)
+
+var unlockPage = template.Must(template.New("unlock").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Password required</title>
+</head>
+<body>
+<h1>This link is password protected</h1>
+{{if .Error}}<p style="color:#b00">{{.Error}}</p>{{end}}
+<form method="post" action="{{.Action}}">
+<input type="password" name="password" placeholder="Password" autofocus required>
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>
+`))
+
+// UnlockURL checks the password for a protected link. On success it sets a
+// short-lived signed cookie, so repeat visits skip the challenge, and follows
+// the link. Repeated wrong passwords lock the caller out of the link for a
+// while.
+func UnlockURL(c *gin.Context) {
+	url, ok := findRedirectURL(c)
+	if !ok {
+		return
+	}
+
+	if url.Password == "" {
+		followURL(c, url)
+		return
+	}
+
+	if wait := linkUnlockRetryAfter(c, url); wait > 0 {
+		rejectUnlockAttempt(c, wait)
+		return
+	}
+
+	var input struct {
+		Password string `json:"password" form:"password"`
+	}
+	if err := c.ShouldBind(&input); err != nil || input.Password == "" {
+		challengePassword(c, url, "password is required")
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(url.Password), []byte(input.Password)); err != nil {
+		recordLinkUnlockFailure(c, url)
+		challengePassword(c, url, "incorrect password")
+		return
+	}
+	clearLinkUnlockFailures(c, url)
+
+	if cookie, err := newUnlockCookie(url); err == nil {
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(unlockCookieName(url), cookie, int(unlockTTL.Seconds()), "/", "", c.Request.TLS != nil, true)
+	}
+
+	followURL(c, url)
+}
+
+// challengePassword asks for the link password: an HTML form for browsers and
+// a JSON 401 for API clients.
+func challengePassword(c *gin.Context, url models.URL, message string) {
+	if c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) != gin.MIMEHTML {
+		if message == "" {
+			message = "password required"
+		}
+		c.JSON(http.StatusUnauthorized, util.ResponseError(message))
+		return
+	}
+	renderUnlockPage(c, http.StatusUnauthorized, message)
+}
+
+// rejectUnlockAttempt answers a locked-out caller with a 429, as the form
+// with the error for browsers.
+func rejectUnlockAttempt(c *gin.Context, wait time.Duration) {
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+
+	if c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) != gin.MIMEHTML {
+		c.JSON(http.StatusTooManyRequests, util.ResponseErrorMeta("too many incorrect passwords", gin.H{
+			"reason":      "too_many_attempts",
+			"retry_after": retryAfter,
+		}))
+		return
+	}
+	minutes := int(math.Ceil(wait.Minutes()))
+	renderUnlockPage(c, http.StatusTooManyRequests, fmt.Sprintf("too many incorrect passwords, try again in %d minute(s)", minutes))
+}
+
+func renderUnlockPage(c *gin.Context, status int, message string) {
+	action := c.Request.URL.Path
+	if c.Request.Method != http.MethodPost {
+		action += "/unlock"
+	}
+
+	c.Status(status)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	unlockPage.Execute(c.Writer, gin.H{
+		"Action": action,
+		"Error":  message,
+	})
+}
+
+func hasUnlockCookie(c *gin.Context, url models.URL) bool {
+	raw, err := c.Cookie(unlockCookieName(url))
+	if err != nil {
+		return false
+	}
+
+	claims, err := tokens.Parse(raw, tokens.TypeUnlock)
+	if err != nil {
+		return false
+	}
+	return claims["sub"] == url.ShortCode &&
+		claims["pwh"] == passwordFingerprint(url)
+}
+
+// newUnlockCookie signs a cookie for a link. It carries a fingerprint of the
+// password hash, so changing the password invalidates earlier unlocks.
+func newUnlockCookie(url models.URL) (string, error) {
+	return tokens.Issue(tokens.TypeUnlock, jwt.MapClaims{
+		"sub": url.ShortCode,
+		"pwh": passwordFingerprint(url),
+	}, unlockTTL)
+}
+
+func hashLinkPassword(password string) (string, error) {
+	if len(password) < minLinkPasswordLen {
+		return "", fmt.Errorf("password must be at least %d characters", minLinkPasswordLen)
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", errors.New("failed to hash password")
+	}
+	return string(hashed), nil
+}
+
+func unlockCookieName(url models.URL) string {
+	return "unlock_" + url.ShortCode
+}
+
+func passwordFingerprint(url models.URL) string {
+	sum := sha256.Sum256([]byte(url.Password))
+	return hex.EncodeToString(sum[:8])
+}
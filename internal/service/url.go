@@ -1,6 +1,7 @@
 package service
 
 import (
+	"errors"
 	"net/http"
 	"os"
 	"time"
@@ -9,12 +10,23 @@ import (
 	"url-shortener/internal/util"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
 	"gorm.io/gorm"
 )
 
+const urlCacheTTL = time.Hour
+
 func ShortenURL(c *gin.Context) {
 	var input struct {
-		OriginalURL string `json:"original_url" validate:"required,url"`
+		OriginalURL    string     `json:"original_url" validate:"required,url"`
+		Alias          string     `json:"alias"`
+		ExpiresAt      *time.Time `json:"expires_at"`
+		ExpiresIn      string     `json:"expires_in"`
+		Password       string     `json:"password"`
+		MaxClicks      *int       `json:"max_clicks"`
+		ActiveFrom     *time.Time `json:"active_from"`
+		FallbackURL    string     `json:"fallback_url" validate:"omitempty,url"`
+		RedirectStatus int        `json:"redirect_status"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -22,13 +34,74 @@ func ShortenURL(c *gin.Context) {
 		return
 	}
 
+	validate := validator.New()
+	if err := validate.Struct(input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+
 	shortCode := util.GenerateShortCode()
+	if input.Alias != "" {
+		if err := util.ValidateAlias(input.Alias); err != nil {
+			c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+			return
+		}
+		if aliasTaken(input.Alias) {
+			c.JSON(http.StatusConflict, util.ResponseError("alias already taken"))
+			return
+		}
+		shortCode = input.Alias
+	}
+
+	expiresAt, err := util.ResolveExpiry(input.ExpiresAt, input.ExpiresIn)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+
+	_, isUser := c.Get("user_id")
+	if expiresAt == nil && !isUser {
+		if expiresAt, err = guestLinkExpiry(); err != nil {
+			c.JSON(http.StatusInternalServerError, util.ResponseError("invalid GUEST_LINK_EXPIRY: "+err.Error()))
+			return
+		}
+	}
+
+	if input.ActiveFrom != nil && expiresAt != nil && !input.ActiveFrom.Before(*expiresAt) {
+		c.JSON(http.StatusBadRequest, util.ResponseError("active_from must be before the expiry"))
+		return
+	}
+
+	if input.RedirectStatus != 0 && !util.ValidRedirectStatus(input.RedirectStatus) {
+		c.JSON(http.StatusBadRequest, util.ResponseError("redirect_status must be one of 301, 302, 307 or 308"))
+		return
+	}
+
+	if input.MaxClicks != nil && *input.MaxClicks < 1 {
+		c.JSON(http.StatusBadRequest, util.ResponseError("max_clicks must be at least 1"))
+		return
+	}
 
 	url := models.URL{
-		OriginalURL: input.OriginalURL,
-		ShortCode:   shortCode,
+		OriginalURL:    input.OriginalURL,
+		ShortCode:      shortCode,
+		ExpiresAt:      expiresAt,
+		MaxClicks:      input.MaxClicks,
+		ActiveFrom:     input.ActiveFrom,
+		FallbackURL:    input.FallbackURL,
+		RedirectStatus: input.RedirectStatus,
 	}
 
+	if input.Password != "" {
+		hashed, err := hashLinkPassword(input.Password)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+			return
+		}
+		url.Password = hashed
+	}
+
+	var manageToken string
 	if userID, ok := c.Get("user_id"); ok {
 		userIDValue := userID.(uint)
 		// Validate that the user exists before associating the URL
@@ -37,88 +110,218 @@ func ShortenURL(c *gin.Context) {
 			c.JSON(http.StatusUnauthorized, util.ResponseError("user not found"))
 			return
 		}
+		if !checkUnverifiedQuota(c, user) {
+			return
+		}
 		url.UserID = &userIDValue
+		if workspaceID := c.GetUint("workspace_id"); workspaceID != 0 {
+			url.WorkspaceID = &workspaceID
+		}
 	} else {
 		sessionID := c.GetUint("session_id")
+		if !checkGuestQuota(c, sessionID) {
+			return
+		}
 		url.SessionID = &sessionID
+		url.CreatorIP = util.ClientNetwork(c)
+
+		// guests get a secret to manage the link with, as their session
+		// may not outlive it. Only its hash is stored.
+		manageToken = util.GenerateSecureToken()
+		url.ManageToken = util.HashToken(manageToken)
 	}
 
-	if err := config.DB.Create(&url).Error; err != nil {
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&url).Error; err != nil {
+			return err
+		}
+		return recordVersion(tx, c, url.ID, "", url.OriginalURL)
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusConflict, util.ResponseError("short code already taken"))
+			return
+		}
 		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
 		return
 	}
 
-	c.JSON(http.StatusCreated, util.ResponseSuccess(gin.H{
-		"short_code": shortCode,
-		"short_url":  os.Getenv("SERVER_URL") + "/url/redirect/" + shortCode,
-	}))
+	response := gin.H{
+		"short_code":         shortCode,
+		"short_url":          util.ShortURL(shortCode),
+		"expires_at":         expiresAt,
+		"password_protected": url.Password != "",
+		"max_clicks":         url.MaxClicks,
+		"active_from":        url.ActiveFrom,
+		"fallback_url":       url.FallbackURL,
+		"redirect_status":    redirectStatus(url),
+	}
+	if url.WorkspaceID != nil {
+		response["workspace_id"] = *url.WorkspaceID
+	}
+	if manageToken != "" {
+		response["manage_token"] = manageToken
+	}
+	c.JSON(http.StatusCreated, util.ResponseSuccess(response))
 }
 
 func RedirectURL(c *gin.Context) {
-	shortCode := c.Param("code")
+	url, ok := findRedirectURL(c)
+	if !ok {
+		return
+	}
 
-	// Check cache (skip if Redis is not available)
-	if config.RedisClient != nil {
-		cachedURL, err := config.RedisClient.Get(config.RedisClient.Context(), shortCode).Result()
-		if err == nil {
-			// Find URL first to get ID for click record
-			var url models.URL
-			if err := config.DB.Where("short_code = ?", shortCode).First(&url).Error; err != nil {
-				c.JSON(http.StatusNotFound, util.ResponseError("URL not found"))
-				return
-			}
-			if url.ExpiresAt != nil && time.Now().After(*url.ExpiresAt) {
-				c.JSON(http.StatusGone, util.ResponseError("URL expired"))
-				return
-			}
-
-			// Create click record
-			ip := c.ClientIP()
-			userAgent := c.GetHeader("User-Agent")
-			click := models.Click{
-				URLID:     url.ID,
-				IP:        ip,
-				UserAgent: userAgent,
-			}
-			if err := config.DB.Create(&click).Error; err != nil {
-				// Log error but don't fail the redirect
-			}
-			config.DB.Model(&url).Update("clicks", gorm.Expr("clicks + 1"))
-			c.Redirect(http.StatusMovedPermanently, cachedURL)
-			return
-		}
+	if url.Password != "" && !hasUnlockCookie(c, url) {
+		challengePassword(c, url, "")
+		return
 	}
 
+	followURL(c, url)
+}
+
+// findRedirectURL loads the link named by the :code param and checks that it
+// can currently be followed. It writes the error response itself.
+func findRedirectURL(c *gin.Context) (models.URL, bool) {
 	var url models.URL
-	if err := config.DB.Where("short_code = ?", shortCode).First(&url).Error; err != nil {
+	if err := config.DB.Where("short_code = ?", c.Param("code")).First(&url).Error; err != nil {
 		c.JSON(http.StatusNotFound, util.ResponseError("URL not found"))
-		return
+		return url, false
+	}
+
+	if url.DisabledAt != nil {
+		c.JSON(http.StatusGone, util.ResponseErrorMeta("URL disabled", gin.H{"reason": "disabled"}))
+		return url, false
+	}
+
+	if url.ActiveFrom != nil && time.Now().Before(*url.ActiveFrom) {
+		respondNotYetActive(c, url)
+		return url, false
 	}
 
 	if url.ExpiresAt != nil && time.Now().After(*url.ExpiresAt) {
-		c.JSON(http.StatusGone, util.ResponseError("URL expired"))
+		respondExpired(c, url)
+		return url, false
+	}
+
+	if url.MaxClicks != nil && url.Clicks >= *url.MaxClicks {
+		respondClickLimitReached(c, url)
+		return url, false
+	}
+
+	return url, true
+}
+
+// followURL counts a click for the link and redirects to its destination.
+// The click counter is only bumped while it is under max_clicks, in a single
+// UPDATE, so concurrent redirects can't overshoot the limit.
+func followURL(c *gin.Context, url models.URL) {
+	result := config.DB.Model(&url).
+		Where("max_clicks IS NULL OR clicks < max_clicks").
+		Update("clicks", gorm.Expr("clicks + 1"))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(result.Error.Error()))
+		return
+	}
+	if result.RowsAffected == 0 {
+		respondClickLimitReached(c, url)
 		return
 	}
 
-	// Create click record
-	ip := c.ClientIP()
-	userAgent := c.GetHeader("User-Agent")
 	click := models.Click{
 		URLID:     url.ID,
-		IP:        ip,
-		UserAgent: userAgent,
+		IP:        c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
 	}
 	if err := config.DB.Create(&click).Error; err != nil {
 		// Log error but don't fail the redirect
 	}
 
-	// Cache (skip if Redis is not available)
-	if config.RedisClient != nil {
-		config.RedisClient.Set(config.RedisClient.Context(), shortCode, url.OriginalURL, time.Hour)
+	c.Redirect(redirectStatus(url), resolveDestination(c, url))
+}
+
+// respondNotYetActive answers for a link before its active_from time. When
+// LINK_NOT_ACTIVE_URL is set visitors are sent there, otherwise they get a
+// JSON error with LINK_NOT_ACTIVE_STATUS (403 by default).
+func respondNotYetActive(c *gin.Context, url models.URL) {
+	if target := os.Getenv("LINK_NOT_ACTIVE_URL"); target != "" {
+		c.Redirect(http.StatusFound, target)
+		return
 	}
 
-	config.DB.Model(&url).Update("clicks", url.Clicks+1)
-	c.Redirect(http.StatusMovedPermanently, url.OriginalURL)
+	status := config.GetEnvInt("LINK_NOT_ACTIVE_STATUS", http.StatusForbidden)
+	if status < 400 || status > 599 {
+		status = http.StatusForbidden
+	}
+	c.JSON(status, util.ResponseErrorMeta("URL not yet active", gin.H{
+		"reason":      "not_yet_active",
+		"active_from": url.ActiveFrom,
+	}))
+}
+
+// redirectStatus picks the status code for following a link: its own
+// redirect_status when set, otherwise DEFAULT_REDIRECT_STATUS (302). Browsers
+// cache permanent redirects indefinitely and every link can still be edited,
+// so a link only redirects permanently when it asked to; a permanent instance
+// default becomes its temporary counterpart (301 to 302, 308 to 307).
+func redirectStatus(url models.URL) int {
+	if url.RedirectStatus != 0 {
+		return url.RedirectStatus
+	}
+
+	status := config.GetEnvInt("DEFAULT_REDIRECT_STATUS", http.StatusFound)
+	switch status {
+	case http.StatusMovedPermanently:
+		return http.StatusFound
+	case http.StatusPermanentRedirect:
+		return http.StatusTemporaryRedirect
+	}
+	if !util.ValidRedirectStatus(status) {
+		return http.StatusFound
+	}
+	return status
+}
+
+func respondExpired(c *gin.Context, url models.URL) {
+	if followFallback(c, url) {
+		return
+	}
+	c.JSON(http.StatusGone, util.ResponseErrorMeta("URL expired", gin.H{"reason": "expired"}))
+}
+
+func respondClickLimitReached(c *gin.Context, url models.URL) {
+	if followFallback(c, url) {
+		return
+	}
+	c.JSON(http.StatusGone, util.ResponseErrorMeta("URL click limit reached", gin.H{"reason": "click_limit_reached"}))
+}
+
+// followFallback sends visitors of a dead link to its fallback_url, or to the
+// owner's default_fallback_url, recording the click as a fallback. It reports
+// false when neither is set.
+func followFallback(c *gin.Context, url models.URL) bool {
+	target := url.FallbackURL
+	if target == "" && url.UserID != nil {
+		var owner models.User
+		if err := config.DB.Select("default_fallback_url").First(&owner, *url.UserID).Error; err == nil {
+			target = owner.DefaultFallbackURL
+		}
+	}
+	if target == "" {
+		return false
+	}
+
+	click := models.Click{
+		URLID:     url.ID,
+		IP:        c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+		Fallback:  true,
+	}
+	if err := config.DB.Create(&click).Error; err != nil {
+		// Log error but don't fail the redirect
+	}
+
+	c.Redirect(http.StatusFound, target)
+	return true
 }
 
 func GetHistory(c *gin.Context) {
@@ -139,7 +342,11 @@ func GetHistory(c *gin.Context) {
 	query := config.DB.Model(&models.URL{})
 
 	if userID, ok := c.Get("user_id"); ok {
-		query = query.Where("user_id = ?", userID)
+		if workspaceID := c.GetUint("workspace_id"); workspaceID != 0 {
+			query = query.Where("workspace_id = ?", workspaceID)
+		} else {
+			query = query.Where("user_id = ? AND workspace_id IS NULL", userID)
+		}
 	} else {
 		sessionID := c.GetUint("session_id")
 		if sessionID == 0 {
@@ -161,15 +368,7 @@ func GetHistory(c *gin.Context) {
 
 	history := make([]models.HistoryItem, 0, len(urls))
 	for _, u := range urls {
-		history = append(history, models.HistoryItem{
-			ID:          u.ID,
-			OriginalURL: u.OriginalURL,
-			ShortCode:   u.ShortCode,
-			ShortURL:    os.Getenv("SERVER_URL") + "/url/redirect/" + u.ShortCode,
-			Clicks:      u.Clicks,
-			ExpiresAt:   u.ExpiresAt,
-			CreatedAt:   u.CreatedAt,
-		})
+		history = append(history, newHistoryItem(u))
 	}
 
 	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
@@ -182,50 +381,310 @@ func GetHistory(c *gin.Context) {
 	}))
 }
 
+func UpdateURL(c *gin.Context) {
+	var input struct {
+		OriginalURL    string     `json:"original_url" validate:"omitempty,url"`
+		Alias          string     `json:"alias"`
+		ExpiresAt      *time.Time `json:"expires_at"`
+		ExpiresIn      string     `json:"expires_in"`
+		NoExpiry       bool       `json:"no_expiry"`
+		Password       string     `json:"password"`
+		RemovePassword bool       `json:"remove_password"`
+		MaxClicks      *int       `json:"max_clicks"`
+		ActiveFrom     *time.Time `json:"active_from"`
+		NoActiveFrom   bool       `json:"no_active_from"`
+		FallbackURL    *string    `json:"fallback_url" validate:"omitempty,url"`
+		RedirectStatus *int       `json:"redirect_status"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+
+	url, ok := findOwnedURL(c)
+	if !ok {
+		return
+	}
+	oldCode, oldURL := url.ShortCode, url.OriginalURL
+	// what the link will end up with, to check the window as a whole
+	activeFrom, expiresAt := url.ActiveFrom, url.ExpiresAt
+
+	updates := map[string]interface{}{}
+
+	if input.OriginalURL != "" && input.OriginalURL != url.OriginalURL {
+		updates["original_url"] = input.OriginalURL
+	}
+
+	if input.Alias != "" && input.Alias != url.ShortCode {
+		if err := util.ValidateAlias(input.Alias); err != nil {
+			c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+			return
+		}
+		if aliasTaken(input.Alias) {
+			c.JSON(http.StatusConflict, util.ResponseError("alias already taken"))
+			return
+		}
+		updates["short_code"] = input.Alias
+	}
+
+	if input.NoExpiry {
+		if input.ExpiresAt != nil || input.ExpiresIn != "" {
+			c.JSON(http.StatusBadRequest, util.ResponseError("no_expiry cannot be combined with expires_at or expires_in"))
+			return
+		}
+		updates["expires_at"] = nil
+		expiresAt = nil
+	} else if input.ExpiresAt != nil || input.ExpiresIn != "" {
+		resolved, err := util.ResolveExpiry(input.ExpiresAt, input.ExpiresIn)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+			return
+		}
+		updates["expires_at"] = resolved
+		expiresAt = resolved
+	}
+
+	if input.RemovePassword {
+		if input.Password != "" {
+			c.JSON(http.StatusBadRequest, util.ResponseError("remove_password cannot be combined with password"))
+			return
+		}
+		updates["password"] = ""
+	} else if input.Password != "" {
+		hashed, err := hashLinkPassword(input.Password)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+			return
+		}
+		updates["password"] = hashed
+	}
+
+	if input.NoActiveFrom {
+		if input.ActiveFrom != nil {
+			c.JSON(http.StatusBadRequest, util.ResponseError("no_active_from cannot be combined with active_from"))
+			return
+		}
+		updates["active_from"] = nil
+		activeFrom = nil
+	} else if input.ActiveFrom != nil {
+		updates["active_from"] = *input.ActiveFrom
+		activeFrom = input.ActiveFrom
+	}
+
+	_, expiryChanged := updates["expires_at"]
+	_, activeFromChanged := updates["active_from"]
+	if (expiryChanged || activeFromChanged) && activeFrom != nil && expiresAt != nil && !activeFrom.Before(*expiresAt) {
+		c.JSON(http.StatusBadRequest, util.ResponseError("active_from must be before the expiry"))
+		return
+	}
+
+	// an empty fallback_url removes it
+	if input.FallbackURL != nil {
+		updates["fallback_url"] = *input.FallbackURL
+	}
+
+	// redirect_status of 0 goes back to the instance default
+	if input.RedirectStatus != nil {
+		if *input.RedirectStatus != 0 && !util.ValidRedirectStatus(*input.RedirectStatus) {
+			c.JSON(http.StatusBadRequest, util.ResponseError("redirect_status must be one of 301, 302, 307 or 308"))
+			return
+		}
+		updates["redirect_status"] = *input.RedirectStatus
+	}
+
+	// max_clicks of 0 removes the limit
+	if input.MaxClicks != nil {
+		switch {
+		case *input.MaxClicks < 0:
+			c.JSON(http.StatusBadRequest, util.ResponseError("max_clicks cannot be negative"))
+			return
+		case *input.MaxClicks == 0:
+			updates["max_clicks"] = nil
+		default:
+			updates["max_clicks"] = *input.MaxClicks
+		}
+	}
+
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, util.ResponseError("nothing to update"))
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&url).Updates(updates).Error; err != nil {
+			return err
+		}
+		if newURL, ok := updates["original_url"]; ok {
+			return recordVersion(tx, c, url.ID, oldURL, newURL.(string))
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusConflict, util.ResponseError("alias already taken"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	evictURL(c, oldCode)
+
+	if err := config.DB.First(&url, url.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(newHistoryItem(url)))
+}
+
 func DeleteURL(c *gin.Context) {
+	url, ok := findOwnedURL(c)
+	if !ok {
+		return
+	}
+
+	if err := config.DB.Where("url_id = ?", url.ID).
+		Delete(&models.Click{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	if err := config.DB.Delete(&url).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	evictURL(c, url.ShortCode)
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
+		"message": "URL deleted successfully",
+	}))
+}
+
+// findOwnedURL loads the link named by the :code param, scoped to the
+// caller's personal links or the workspace picked by the WorkspaceRole
+// policy. Guests are scoped to their session or the link's management token.
+// It writes the error response itself and reports false when the caller
+// can't manage the link.
+func findOwnedURL(c *gin.Context) (models.URL, bool) {
+	var url models.URL
+
 	shortCode := c.Param("code")
 	if shortCode == "" {
 		c.JSON(http.StatusBadRequest, util.ResponseError("code is required"))
-		return
+		return url, false
 	}
 
-	var url models.URL
 	query := config.DB.Where("short_code = ?", shortCode)
 
-	// NEW AUTH FLOW
 	if userID, ok := util.GetUserID(c); ok {
-		query = query.Where("user_id = ?", userID)
+		if workspaceID := c.GetUint("workspace_id"); workspaceID != 0 {
+			query = query.Where("workspace_id = ?", workspaceID)
+		} else {
+			query = query.Where("user_id = ? AND workspace_id IS NULL", userID)
+		}
 	} else {
 		sessionID := c.GetUint("session_id")
-		if sessionID == 0 {
+		manageToken := c.GetString("manage_token")
+		if sessionID == 0 && manageToken == "" {
 			c.JSON(http.StatusUnauthorized, util.ResponseError("unauthorized"))
-			return
+			return url, false
 		}
-		query = query.Where("session_id = ?", sessionID)
+		// either proves the caller created the link
+		guest := config.DB.Where("session_id = ?", sessionID)
+		if manageToken != "" {
+			guest = guest.Or("manage_token_hash = ?", util.HashToken(manageToken))
+		}
+		query = query.Where("user_id IS NULL").Where(guest)
 	}
 
 	if err := query.First(&url).Error; err != nil {
 		c.JSON(http.StatusNotFound, util.ResponseError("URL not found"))
+		return url, false
+	}
+
+	return url, true
+}
+
+// aliasTaken reports whether a short code is in use. short_code is unique
+// across soft-deleted rows too, so those are checked as well.
+func aliasTaken(alias string) bool {
+	var existing models.URL
+	return config.DB.Unscoped().Where("short_code = ?", alias).First(&existing).Error == nil
+}
+
+func newHistoryItem(u models.URL) models.HistoryItem {
+	item := models.HistoryItem{
+		ID:                u.ID,
+		OriginalURL:       u.OriginalURL,
+		ShortCode:         u.ShortCode,
+		ShortURL:          util.ShortURL(u.ShortCode),
+		WorkspaceID:       u.WorkspaceID,
+		DisabledAt:        u.DisabledAt,
+		Clicks:            u.Clicks,
+		ExpiresAt:         u.ExpiresAt,
+		ActiveFrom:        u.ActiveFrom,
+		MaxClicks:         u.MaxClicks,
+		PasswordProtected: u.Password != "",
+		FallbackURL:       u.FallbackURL,
+		RedirectStatus:    redirectStatus(u),
+		CreatedAt:         u.CreatedAt,
+	}
+	if u.WorkspaceID != nil {
+		item.CreatedByUserID = u.UserID
+	}
+	return item
+}
+
+// cacheURL stores the destination for a short code in Redis. The TTL never
+// outlives the link's own expiry, so an expired link can't be served from cache.
+func cacheURL(c *gin.Context, url models.URL) {
+	if config.RedisClient == nil {
 		return
 	}
 
-	if err := config.DB.Where("url_id = ?", url.ID).
-		Delete(&models.Click{}).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+	// never cache a link that isn't live yet
+	if url.ActiveFrom != nil && time.Now().Before(*url.ActiveFrom) {
 		return
 	}
 
-	if err := config.DB.Delete(&url).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+	ttl := urlCacheTTL
+	if url.ExpiresAt != nil {
+		if remaining := time.Until(*url.ExpiresAt); remaining < ttl {
+			ttl = remaining
+		}
+	}
+	if ttl <= 0 {
 		return
 	}
 
-	// Clear cache (skip if Redis is not available)
+	config.RedisClient.Set(c.Request.Context(), url.ShortCode, url.OriginalURL, ttl)
+}
+
+// resolveDestination returns the cached destination for a link, populating
+// the cache from the row on a miss.
+func resolveDestination(c *gin.Context, url models.URL) string {
 	if config.RedisClient != nil {
-		config.RedisClient.Del(c.Request.Context(), shortCode)
+		if cached, err := config.RedisClient.Get(c.Request.Context(), url.ShortCode).Result(); err == nil {
+			return cached
+		}
 	}
 
-	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
-		"message": "URL deleted successfully",
-	}))
+	cacheURL(c, url)
+	return url.OriginalURL
+}
+
+func evictURL(c *gin.Context, shortCode string) {
+	if config.RedisClient == nil {
+		return
+	}
+	config.RedisClient.Del(c.Request.Context(), shortCode)
 }
@@ -2,47 +2,66 @@ package service
 
 import (
 	"net/http"
-	"os"
+	"strings"
 	"time"
 	"url-shortener/internal/config"
+	"url-shortener/internal/middleware"
 	"url-shortener/internal/models"
+	"url-shortener/internal/tokens"
 	"url-shortener/internal/util"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
 )
 
 func RegisterUser(c *gin.Context) {
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
+	var input struct {
+		Email    string `json:"email" validate:"required,email"`
+		Name     string `json:"name" validate:"required"`
+		Password string `json:"password" validate:"required,min=6"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
 		return
 	}
 
 	validate := validator.New()
-	if err := validate.Struct(user); err != nil {
+	if err := validate.Struct(input); err != nil {
 		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
 		return
 	}
 
 	var existing models.User
-	if err := config.DB.Where("email = ?", user.Email).First(&existing).Error; err == nil {
+	if err := config.DB.Where("email = ?", input.Email).First(&existing).Error; err == nil {
 		c.JSON(http.StatusConflict, util.ResponseError("email already registered"))
 		return
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, util.ResponseError("failed to hash password"))
 		return
 	}
-	user.Password = string(hashedPassword)
 
-	config.DB.Create(&user)
-	user.Password = ""
-	c.JSON(http.StatusCreated, util.ResponseSuccess("User registered successfully"))
+	user := models.User{
+		Email:    input.Email,
+		Name:     input.Name,
+		Password: string(hashedPassword),
+	}
+	if err := config.DB.Create(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError("failed to create user"))
+		return
+	}
+
+	// a failed send is logged; the user can ask for another link
+	sendVerificationEmail(user)
+
+	c.JSON(http.StatusCreated, util.ResponseSuccess(gin.H{
+		"message":       "User registered successfully",
+		"claimed_links": claimGuestLinks(c, user.ID),
+	}))
 }
 
 func LoginUser(c *gin.Context) {
@@ -61,26 +80,81 @@ func LoginUser(c *gin.Context) {
 		return
 	}
 
+	if !checkLoginAllowed(c, input.Email) {
+		return
+	}
+
 	var user models.User
 	if err := config.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
+		recordLoginFailure(c, input.Email, nil)
 		c.JSON(http.StatusUnauthorized, util.ResponseError("invalid credentials"))
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+		recordLoginFailure(c, input.Email, &user)
 		c.JSON(http.StatusUnauthorized, util.ResponseError("invalid credentials"))
 		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.ID,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
-	})
-	tokenString, _ := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	if user.TOTPEnabledAt == nil {
+		clearLoginFailures(c.Request.Context(), user.Email)
+	}
+	completeLogin(c, user)
+}
 
-	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
-		"token": tokenString,
+// checkAccountEnabled turns away disabled accounts once their credentials
+// checked out, so the response doesn't tell strangers which accounts exist.
+// It writes the 403 itself.
+func checkAccountEnabled(c *gin.Context, user models.User) bool {
+	if user.DisabledAt == nil {
+		return true
+	}
+	c.JSON(http.StatusForbidden, util.ResponseErrorMeta("this account has been disabled", gin.H{
+		"reason": "account_disabled",
 	}))
+	return false
+}
+
+// signIn finishes a login: the browser's guest links move to the account
+// and a new access/refresh pair is returned.
+func signIn(c *gin.Context, userID uint) {
+	respondWithTokens(c, userID, gin.H{
+		"claimed_links": claimGuestLinks(c, userID),
+	})
+}
+
+// claimGuestLinks moves the request's guest session links to the user. A
+// failed claim is logged rather than failing the login; the session stays
+// usable, so the links can be claimed on the next one.
+func claimGuestLinks(c *gin.Context, userID uint) int64 {
+	claimed, err := middleware.LinkSessionToUser(c, userID)
+	if err != nil {
+		logrus.WithError(err).WithField("user_id", userID).Warn("Failed to claim guest links")
+	}
+	return claimed
+}
+
+// respondWithTokens starts a new login for the user, who just authenticated,
+// and returns its access/refresh pair along with any extra fields. "token"
+// duplicates the access token for older clients.
+func respondWithTokens(c *gin.Context, userID uint, extra gin.H) {
+	access, refresh, err := middleware.GenerateTokens(userID, "", time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError("failed to issue tokens"))
+		return
+	}
+
+	data := gin.H{
+		"token":         access,
+		"access_token":  access,
+		"refresh_token": refresh,
+		"expires_in":    int(middleware.AccessTokenTTL.Seconds()),
+	}
+	for k, v := range extra {
+		data[k] = v
+	}
+	c.JSON(http.StatusOK, util.ResponseSuccess(data))
 }
 
 func GetUsers(c *gin.Context) {
@@ -101,3 +175,127 @@ func GetUsers(c *gin.Context) {
 	c.JSON(http.StatusOK, util.ResponseSuccess(users))
 }
 
+func UpdateProfile(c *gin.Context) {
+	var input struct {
+		Name               *string `json:"name"`
+		DefaultFallbackURL *string `json:"default_fallback_url" validate:"omitempty,url"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+
+	userID, ok := util.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, util.ResponseError("invalid token"))
+		return
+	}
+
+	updates := map[string]interface{}{}
+
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, util.ResponseError("name cannot be empty"))
+			return
+		}
+		updates["name"] = name
+	}
+
+	// an empty default_fallback_url removes it
+	if input.DefaultFallbackURL != nil {
+		updates["default_fallback_url"] = *input.DefaultFallbackURL
+	}
+
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, util.ResponseError("nothing to update"))
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, util.ResponseError("user not found"))
+		return
+	}
+
+	if err := config.DB.Model(&user).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	config.DB.First(&user, userID)
+	user.Password = ""
+	c.JSON(http.StatusOK, util.ResponseSuccess(user))
+}
+
+// Logout revokes the access token used for the request and, when given, the
+// refresh token family it was issued with.
+func Logout(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	c.ShouldBindJSON(&input)
+
+	claims, ok := util.GetTokenClaims(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, util.ResponseError("invalid token"))
+		return
+	}
+
+	jti, _ := claims["jti"].(string)
+	exp, _ := claims.GetExpirationTime()
+	if exp != nil {
+		if err := middleware.RevokeToken(jti, exp.Time); err != nil {
+			c.JSON(http.StatusInternalServerError, util.ResponseError("failed to revoke token"))
+			return
+		}
+	}
+
+	if input.RefreshToken != "" {
+		userID, _ := util.GetUserID(c)
+		var record models.RefreshToken
+		if err := config.DB.Where("jti = ? AND user_id = ?", refreshTokenID(input.RefreshToken), userID).
+			First(&record).Error; err == nil {
+			middleware.RevokeTokenFamily(record.FamilyID)
+		}
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
+		"message": "logged out",
+	}))
+}
+
+// LogoutAll revokes every access and refresh token of the user.
+func LogoutAll(c *gin.Context) {
+	userID, ok := util.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, util.ResponseError("invalid token"))
+		return
+	}
+
+	if err := middleware.RevokeUserTokens(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError("failed to revoke tokens"))
+		return
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
+		"message": "logged out everywhere",
+	}))
+}
+
+// refreshTokenID returns the jti of a valid refresh token, or "" if the
+// token doesn't verify.
+func refreshTokenID(raw string) string {
+	claims, err := tokens.Parse(raw, tokens.TypeRefresh)
+	if err != nil {
+		return ""
+	}
+	jti, _ := claims["jti"].(string)
+	return jti
+}
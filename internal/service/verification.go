@@ -0,0 +1,157 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+	"url-shortener/internal/config"
+	"url-shortener/internal/mail"
+	"url-shortener/internal/models"
+	"url-shortener/internal/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const verifyEmailTTL = 48 * time.Hour
+
+// VerifyEmail redeems a verification token, from the emailed link (GET) or
+// posted by a frontend (POST). It confirms either a new account's address or
+// a pending email change.
+func VerifyEmail(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" form:"token"`
+	}
+	c.ShouldBind(&input)
+	if input.Token == "" {
+		input.Token = c.Query("token")
+	}
+	if input.Token == "" {
+		c.JSON(http.StatusBadRequest, util.ResponseError("token is required"))
+		return
+	}
+
+	token, err := consumeUserToken(input.Token, models.TokenPurposeVerifyEmail, models.TokenPurposeChangeEmail)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(errInvalidToken.Error()))
+		return
+	}
+
+	if token.Purpose == models.TokenPurposeChangeEmail {
+		confirmEmailChange(c, token)
+		return
+	}
+
+	if err := config.DB.Model(&models.User{}).
+		Where("id = ? AND email_verified_at IS NULL", token.UserID).
+		Update("email_verified_at", time.Now()).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
+		"message": "email verified",
+	}))
+}
+
+func ResendVerification(c *gin.Context) {
+	userID, ok := util.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, util.ResponseError("invalid token"))
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, util.ResponseError("user not found"))
+		return
+	}
+
+	if user.EmailVerifiedAt != nil {
+		c.JSON(http.StatusConflict, util.ResponseError("email already verified"))
+		return
+	}
+
+	if err := sendVerificationEmail(user); err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError("failed to send verification email"))
+		return
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
+		"message": "verification email sent",
+	}))
+}
+
+func sendVerificationEmail(user models.User) error {
+	raw, err := issueUserToken(user.ID, models.TokenPurposeVerifyEmail, verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+
+	link := os.Getenv("SERVER_URL") + "/user/verify?token=" + url.QueryEscape(raw)
+	body := fmt.Sprintf("Hi %s,\n\nConfirm your email address by opening this link:\n\n%s\n\nThe link expires in 48 hours.", user.Name, link)
+
+	if err := mail.Client.Send(user.Email, "Verify your email address", body); err != nil {
+		logrus.WithError(err).WithField("user_id", user.ID).Error("Failed to send verification email")
+		return err
+	}
+	return nil
+}
+
+// confirmEmailChange applies a pending email change. The token has to be for
+// the address that is pending now, not one requested before it.
+func confirmEmailChange(c *gin.Context, token models.UserToken) {
+	var user models.User
+	if err := config.DB.First(&user, token.UserID).Error; err != nil ||
+		user.PendingEmail == "" || user.PendingEmail != token.Email {
+		c.JSON(http.StatusBadRequest, util.ResponseError(errInvalidToken.Error()))
+		return
+	}
+
+	err := config.DB.Model(&user).Updates(map[string]interface{}{
+		"email":             user.PendingEmail,
+		"pending_email":     "",
+		"email_verified_at": time.Now(),
+	}).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		c.JSON(http.StatusConflict, util.ResponseError("email already registered"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
+		"message": "email changed",
+	}))
+}
+
+// checkUnverifiedQuota enforces UNVERIFIED_LINK_QUOTA, the number of links an
+// account may own before its email is verified (0 disables the limit). It
+// writes the error response itself.
+func checkUnverifiedQuota(c *gin.Context, user models.User) bool {
+	if user.EmailVerifiedAt != nil {
+		return true
+	}
+
+	quota := config.GetEnvInt("UNVERIFIED_LINK_QUOTA", 10)
+	if quota <= 0 {
+		return true
+	}
+
+	var count int64
+	config.DB.Model(&models.URL{}).Where("user_id = ?", user.ID).Count(&count)
+	if count >= int64(quota) {
+		c.JSON(http.StatusForbidden, util.ResponseErrorMeta("verify your email to create more links", gin.H{
+			"reason": "email_unverified",
+			"limit":  quota,
+		}))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"net/http"
+	"url-shortener/internal/config"
+	"url-shortener/internal/models"
+	"url-shortener/internal/util"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func GetURLVersions(c *gin.Context) {
+	url, ok := findOwnedURL(c)
+	if !ok {
+		return
+	}
+
+	var versions []models.URLVersion
+	if err := config.DB.Where("url_id = ?", url.ID).
+		Order("created_at DESC, id DESC").
+		Find(&versions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
+		"current":  url.OriginalURL,
+		"versions": versions,
+	}))
+}
+
+func RollbackURLVersion(c *gin.Context) {
+	url, ok := findOwnedURL(c)
+	if !ok {
+		return
+	}
+
+	var version models.URLVersion
+	if err := config.DB.Where("id = ? AND url_id = ?", util.ParseInt(c.Param("version")), url.ID).
+		First(&version).Error; err != nil {
+		c.JSON(http.StatusNotFound, util.ResponseError("version not found"))
+		return
+	}
+
+	if version.NewURL == url.OriginalURL {
+		c.JSON(http.StatusOK, util.ResponseSuccess(newHistoryItem(url)))
+		return
+	}
+
+	oldURL := url.OriginalURL
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&url).Update("original_url", version.NewURL).Error; err != nil {
+			return err
+		}
+		return recordVersion(tx, c, url.ID, oldURL, version.NewURL)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	evictURL(c, url.ShortCode)
+
+	url.OriginalURL = version.NewURL
+	c.JSON(http.StatusOK, util.ResponseSuccess(newHistoryItem(url)))
+}
+
+// recordVersion appends a destination change for a link, attributed to
+// whoever is making the request.
+func recordVersion(tx *gorm.DB, c *gin.Context, urlID uint, oldURL, newURL string) error {
+	version := models.URLVersion{
+		URLID:  urlID,
+		OldURL: oldURL,
+		NewURL: newURL,
+	}
+
+	if userID, ok := util.GetUserID(c); ok {
+		version.ChangedByUserID = &userID
+	} else if sessionID := c.GetUint("session_id"); sessionID != 0 {
+		version.ChangedBySessionID = &sessionID
+	}
+
+	return tx.Create(&version).Error
+}
@@ -0,0 +1,494 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"url-shortener/internal/config"
+	"url-shortener/internal/mail"
+	"url-shortener/internal/models"
+	"url-shortener/internal/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const workspaceInviteTTL = 7 * 24 * time.Hour
+
+var errLastOwner = errors.New("a workspace needs at least one owner")
+
+// workspaceMembership loads the caller's membership of the workspace named by
+// the :id param and checks it has at least the min role. It writes the error
+// response itself.
+func workspaceMembership(c *gin.Context, min string) (models.WorkspaceMember, bool) {
+	var member models.WorkspaceMember
+
+	userID, ok := util.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, util.ResponseError("invalid token"))
+		return member, false
+	}
+
+	if err := config.DB.Where("workspace_id = ? AND user_id = ?", util.ParseInt(c.Param("id")), userID).
+		First(&member).Error; err != nil {
+		c.JSON(http.StatusNotFound, util.ResponseError("workspace not found"))
+		return member, false
+	}
+	if !member.HasRole(min) {
+		c.JSON(http.StatusForbidden, util.ResponseError("only workspace "+min+"s can do this"))
+		return member, false
+	}
+
+	return member, true
+}
+
+func CreateWorkspace(c *gin.Context) {
+	var input struct {
+		Name string `json:"name" validate:"required,max=100"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+
+	// the name goes into invite email subjects
+	name := strings.TrimSpace(input.Name)
+	if name == "" || strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		c.JSON(http.StatusBadRequest, util.ResponseError("workspace name can't be blank or contain control characters"))
+		return
+	}
+
+	userID, ok := util.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, util.ResponseError("invalid token"))
+		return
+	}
+
+	workspace := models.Workspace{Name: name}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&workspace).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.WorkspaceMember{
+			WorkspaceID: workspace.ID,
+			UserID:      userID,
+			Role:        models.WorkspaceRoleOwner,
+		}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusCreated, util.ResponseSuccess(gin.H{
+		"workspace": workspace,
+		"role":      models.WorkspaceRoleOwner,
+	}))
+}
+
+// ListWorkspaces lists the workspaces the caller belongs to, with their role
+// in each.
+func ListWorkspaces(c *gin.Context) {
+	userID, ok := util.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, util.ResponseError("invalid token"))
+		return
+	}
+
+	var items []struct {
+		models.Workspace
+		Role string `json:"role"`
+	}
+	if err := config.DB.Model(&models.Workspace{}).
+		Select("workspaces.*, workspace_members.role").
+		Joins("JOIN workspace_members ON workspace_members.workspace_id = workspaces.id").
+		Where("workspace_members.user_id = ?", userID).
+		Order("workspaces.name").
+		Scan(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(items))
+}
+
+// DeleteWorkspace removes an empty workspace. Its links have to be deleted
+// first, so none are lost by accident.
+func DeleteWorkspace(c *gin.Context) {
+	member, ok := workspaceMembership(c, models.WorkspaceRoleOwner)
+	if !ok {
+		return
+	}
+
+	var links int64
+	config.DB.Model(&models.URL{}).Where("workspace_id = ?", member.WorkspaceID).Count(&links)
+	if links > 0 {
+		c.JSON(http.StatusConflict, util.ResponseErrorMeta("delete the workspace's links first", gin.H{
+			"reason": "workspace_not_empty",
+			"links":  links,
+		}))
+		return
+	}
+
+	if err := deleteWorkspace(config.DB, member.WorkspaceID); err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
+		"message": "workspace deleted",
+	}))
+}
+
+func ListWorkspaceMembers(c *gin.Context) {
+	member, ok := workspaceMembership(c, models.WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
+
+	var members []struct {
+		UserID   uint      `json:"user_id"`
+		Email    string    `json:"email"`
+		Name     string    `json:"name"`
+		Role     string    `json:"role"`
+		JoinedAt time.Time `json:"joined_at"`
+	}
+	if err := config.DB.Model(&models.WorkspaceMember{}).
+		Select("workspace_members.user_id, users.email, users.name, workspace_members.role, workspace_members.created_at AS joined_at").
+		Joins("JOIN users ON users.id = workspace_members.user_id").
+		Where("workspace_members.workspace_id = ?", member.WorkspaceID).
+		Order("workspace_members.created_at").
+		Scan(&members).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(members))
+}
+
+// UpdateWorkspaceMember changes a member's role. Owners can't demote the last
+// owner, themselves included.
+func UpdateWorkspaceMember(c *gin.Context) {
+	var input struct {
+		Role string `json:"role" validate:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+	if !slices.Contains(models.WorkspaceRoles, input.Role) {
+		c.JSON(http.StatusBadRequest, util.ResponseError("role must be one of owner, editor or viewer"))
+		return
+	}
+
+	owner, ok := workspaceMembership(c, models.WorkspaceRoleOwner)
+	if !ok {
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		target, err := lockWorkspaceMember(tx, owner.WorkspaceID, uint(util.ParseInt(c.Param("user_id"))))
+		if err != nil {
+			return err
+		}
+		if target.Role == models.WorkspaceRoleOwner && input.Role != models.WorkspaceRoleOwner {
+			if err := ensureAnotherOwner(tx, target); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&target).Update("role", input.Role).Error
+	})
+	if !respondMemberChange(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
+		"message": "member updated",
+	}))
+}
+
+// RemoveWorkspaceMember removes a member. Owners can remove anyone and any
+// member can leave, as long as an owner remains. Links the member created
+// stay with the workspace.
+func RemoveWorkspaceMember(c *gin.Context) {
+	caller, ok := workspaceMembership(c, models.WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
+
+	targetID := uint(util.ParseInt(c.Param("user_id")))
+	if targetID != caller.UserID && !caller.HasRole(models.WorkspaceRoleOwner) {
+		c.JSON(http.StatusForbidden, util.ResponseError("only workspace owners can do this"))
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		target, err := lockWorkspaceMember(tx, caller.WorkspaceID, targetID)
+		if err != nil {
+			return err
+		}
+		if target.Role == models.WorkspaceRoleOwner {
+			if err := ensureAnotherOwner(tx, target); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&target).Error
+	})
+	if !respondMemberChange(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
+		"message": "member removed",
+	}))
+}
+
+// lockWorkspaceMember loads a member and locks the workspace's owner rows, so
+// two concurrent demotions can't both see another owner.
+func lockWorkspaceMember(tx *gorm.DB, workspaceID, userID uint) (models.WorkspaceMember, error) {
+	var owners []models.WorkspaceMember
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("workspace_id = ? AND role = ?", workspaceID, models.WorkspaceRoleOwner).
+		Find(&owners).Error; err != nil {
+		return models.WorkspaceMember{}, err
+	}
+
+	var member models.WorkspaceMember
+	err := tx.Where("workspace_id = ? AND user_id = ?", workspaceID, userID).First(&member).Error
+	return member, err
+}
+
+func ensureAnotherOwner(tx *gorm.DB, member models.WorkspaceMember) error {
+	var owners int64
+	if err := tx.Model(&models.WorkspaceMember{}).
+		Where("workspace_id = ? AND role = ? AND id <> ?", member.WorkspaceID, models.WorkspaceRoleOwner, member.ID).
+		Count(&owners).Error; err != nil {
+		return err
+	}
+	if owners == 0 {
+		return errLastOwner
+	}
+	return nil
+}
+
+func respondMemberChange(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, util.ResponseError("member not found"))
+	case errors.Is(err, errLastOwner):
+		c.JSON(http.StatusConflict, util.ResponseError(err.Error()))
+	default:
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+	}
+	return false
+}
+
+// InviteWorkspaceMember emails an invitation to join the workspace with the
+// given role. Only the account with that email can accept it.
+func InviteWorkspaceMember(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" validate:"required,email"`
+		Role  string `json:"role" validate:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+	if !slices.Contains(models.WorkspaceRoles, input.Role) {
+		c.JSON(http.StatusBadRequest, util.ResponseError("role must be one of owner, editor or viewer"))
+		return
+	}
+
+	owner, ok := workspaceMembership(c, models.WorkspaceRoleOwner)
+	if !ok {
+		return
+	}
+
+	email := strings.TrimSpace(input.Email)
+	var existing int64
+	config.DB.Model(&models.WorkspaceMember{}).
+		Joins("JOIN users ON users.id = workspace_members.user_id").
+		Where("workspace_members.workspace_id = ? AND LOWER(users.email) = LOWER(?)", owner.WorkspaceID, email).
+		Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusConflict, util.ResponseError("already a member of this workspace"))
+		return
+	}
+
+	var workspace models.Workspace
+	if err := config.DB.First(&workspace, owner.WorkspaceID).Error; err != nil {
+		c.JSON(http.StatusNotFound, util.ResponseError("workspace not found"))
+		return
+	}
+
+	raw := util.GenerateSecureToken()
+	invite := models.WorkspaceInvite{
+		WorkspaceID:     workspace.ID,
+		Email:           email,
+		Role:            input.Role,
+		TokenHash:       util.HashToken(raw),
+		InvitedByUserID: owner.UserID,
+		ExpiresAt:       time.Now().Add(workspaceInviteTTL),
+	}
+	if err := config.DB.Create(&invite).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	// a failed send is logged; the owner can invite again
+	sendWorkspaceInviteEmail(workspace, invite, raw)
+
+	c.JSON(http.StatusCreated, util.ResponseSuccess(invite))
+}
+
+// AcceptWorkspaceInvite joins the caller to the workspace of an invite sent
+// to their email. Someone who is already a member keeps their role.
+func AcceptWorkspaceInvite(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, util.ResponseError(err.Error()))
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var invite models.WorkspaceInvite
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// claim the invite in a single conditional UPDATE so it can only be
+		// used once
+		result := tx.Model(&models.WorkspaceInvite{}).
+			Where("token_hash = ? AND accepted_at IS NULL AND expires_at > ? AND LOWER(email) = LOWER(?)",
+				util.HashToken(input.Token), time.Now(), user.Email).
+			Update("accepted_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidToken
+		}
+
+		if err := tx.Where("token_hash = ?", util.HashToken(input.Token)).First(&invite).Error; err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.WorkspaceMember{
+			WorkspaceID: invite.WorkspaceID,
+			UserID:      user.ID,
+			Role:        invite.Role,
+		}).Error
+	})
+	if errors.Is(err, errInvalidToken) {
+		c.JSON(http.StatusBadRequest, util.ResponseError("invalid or expired invite"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.ResponseError(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, util.ResponseSuccess(gin.H{
+		"message":      "joined workspace",
+		"workspace_id": invite.WorkspaceID,
+	}))
+}
+
+func sendWorkspaceInviteEmail(workspace models.Workspace, invite models.WorkspaceInvite, raw string) error {
+	link := os.Getenv("APP_URL") + "/workspaces/join?token=" + url.QueryEscape(raw)
+	body := fmt.Sprintf("Hi,\n\nYou have been invited to join the workspace %q as %s. Accept the invitation by opening this link:\n\n%s\n\nThe link expires in 7 days.", workspace.Name, invite.Role, link)
+
+	if err := mail.Client.Send(invite.Email, "You're invited to "+workspace.Name, body); err != nil {
+		logrus.WithError(err).WithField("workspace_id", workspace.ID).Error("Failed to send workspace invite")
+		return err
+	}
+	return nil
+}
+
+// deleteWorkspace removes a workspace with its members and invites.
+func deleteWorkspace(tx *gorm.DB, workspaceID uint) error {
+	if err := tx.Where("workspace_id = ?", workspaceID).Delete(&models.WorkspaceInvite{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("workspace_id = ?", workspaceID).Delete(&models.WorkspaceMember{}).Error; err != nil {
+		return err
+	}
+	return tx.Delete(&models.Workspace{}, workspaceID).Error
+}
+
+// soleOwnedWorkspaces lists the shared workspaces that would be left without
+// an owner if the user went away.
+func soleOwnedWorkspaces(userID uint) []uint {
+	var ids []uint
+	config.DB.Model(&models.WorkspaceMember{}).
+		Where("user_id = ? AND role = ?", userID, models.WorkspaceRoleOwner).
+		Where("NOT EXISTS (SELECT 1 FROM workspace_members o WHERE o.workspace_id = workspace_members.workspace_id AND o.role = ? AND o.user_id <> ?)",
+			models.WorkspaceRoleOwner, userID).
+		Where("EXISTS (SELECT 1 FROM workspace_members m WHERE m.workspace_id = workspace_members.workspace_id AND m.user_id <> ?)", userID).
+		Pluck("workspace_id", &ids)
+	return ids
+}
+
+// shareWorkspace reports whether both users are members of some workspace,
+// i.e. the other one accepted an invite to work with the user.
+func shareWorkspace(userID, otherID uint) bool {
+	var count int64
+	config.DB.Model(&models.WorkspaceMember{}).
+		Where("user_id = ?", userID).
+		Where("EXISTS (SELECT 1 FROM workspace_members m WHERE m.workspace_id = workspace_members.workspace_id AND m.user_id = ?)", otherID).
+		Count(&count)
+	return count > 0
+}
+
+// releaseWorkspaces detaches a user who is going away from their workspaces.
+// Workspaces they are the only member of are dissolved and their links become
+// the user's own; links they created in shared workspaces stay there without
+// a creator.
+func releaseWorkspaces(tx *gorm.DB, userID uint) error {
+	var solo []uint
+	if err := tx.Model(&models.WorkspaceMember{}).
+		Where("user_id = ?", userID).
+		Where("NOT EXISTS (SELECT 1 FROM workspace_members m WHERE m.workspace_id = workspace_members.workspace_id AND m.user_id <> ?)", userID).
+		Pluck("workspace_id", &solo).Error; err != nil {
+		return err
+	}
+
+	for _, workspaceID := range solo {
+		if err := tx.Unscoped().Model(&models.URL{}).Where("workspace_id = ?", workspaceID).
+			Updates(map[string]interface{}{"workspace_id": nil, "user_id": userID}).Error; err != nil {
+			return err
+		}
+		if err := deleteWorkspace(tx, workspaceID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Unscoped().Model(&models.URL{}).
+		Where("user_id = ? AND workspace_id IS NOT NULL", userID).
+		Update("user_id", nil).Error
+}
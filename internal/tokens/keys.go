@@ -0,0 +1,288 @@
+package tokens
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const minRSABits = 2048
+
+type key struct {
+	id      string
+	method  jwt.SigningMethod
+	private interface{} // nil for verification-only keys
+	public  interface{}
+}
+
+// keyring holds the key new tokens are signed with and every key tokens are
+// still accepted from, by kid.
+type keyring struct {
+	issuer   string
+	audience string
+	signing  *key
+	verify   map[string]*key
+}
+
+// current stays nil until Setup loads a key, which makes Issue and Parse
+// fail closed.
+var current *keyring
+
+// Setup loads the signing configuration from the environment:
+//
+//   - JWT_ALG picks HS256 (default), RS256 or EdDSA.
+//   - HS256 signs with JWT_SECRET; RS256 and EdDSA with the PEM private key
+//     in JWT_PRIVATE_KEY_FILE. JWT_KEY_ID overrides the kid, which otherwise
+//     is the RFC 7638 thumbprint of the public key.
+//   - JWT_VERIFY_KEYS lists PEM public keys, as "path" or "kid=path" and
+//     comma-separated, that are still accepted after a rotation.
+//   - JWT_ISSUER and JWT_AUDIENCE set iss and aud.
+//
+// A broken configuration is logged and leaves token signing disabled.
+func Setup() {
+	ring, err := load()
+	if err != nil {
+		current = nil
+		log.Println("Token signing disabled, all tokens will be rejected:", err)
+		return
+	}
+	current = ring
+	log.Printf("Token signing configured with %s, key %s, %d verification key(s)",
+		ring.signing.method.Alg(), ring.signing.id, len(ring.verify))
+}
+
+func load() (*keyring, error) {
+	ring := &keyring{
+		issuer:   envOr("JWT_ISSUER", "url-shortener"),
+		audience: envOr("JWT_AUDIENCE", "url-shortener"),
+		verify:   map[string]*key{},
+	}
+
+	switch alg := envOr("JWT_ALG", jwt.SigningMethodHS256.Alg()); alg {
+	case jwt.SigningMethodHS256.Alg():
+		secret := os.Getenv("JWT_SECRET")
+		if secret == "" {
+			return nil, errors.New("JWT_SECRET is not set")
+		}
+		ring.signing = &key{
+			id:      envOr("JWT_KEY_ID", "hs256"),
+			method:  jwt.SigningMethodHS256,
+			private: []byte(secret),
+			public:  []byte(secret),
+		}
+	case jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg():
+		path := os.Getenv("JWT_PRIVATE_KEY_FILE")
+		if path == "" {
+			return nil, fmt.Errorf("JWT_PRIVATE_KEY_FILE is required for %s", alg)
+		}
+		signing, err := loadPrivateKey(path)
+		if err != nil {
+			return nil, err
+		}
+		if signing.method.Alg() != alg {
+			return nil, fmt.Errorf("%s holds a %s key, not %s", path, signing.method.Alg(), alg)
+		}
+		if id := os.Getenv("JWT_KEY_ID"); id != "" {
+			signing.id = id
+		}
+		ring.signing = signing
+	default:
+		return nil, fmt.Errorf("unsupported JWT_ALG %q", alg)
+	}
+	ring.verify[ring.signing.id] = ring.signing
+
+	for _, entry := range strings.Split(os.Getenv("JWT_VERIFY_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kid, path, named := strings.Cut(entry, "=")
+		if !named {
+			path, kid = kid, ""
+		}
+		verify, err := loadPublicKey(path)
+		if err != nil {
+			return nil, err
+		}
+		if kid != "" {
+			verify.id = kid
+		}
+		if _, dup := ring.verify[verify.id]; dup {
+			return nil, fmt.Errorf("duplicate key id %q in JWT_VERIFY_KEYS", verify.id)
+		}
+		ring.verify[verify.id] = verify
+	}
+
+	return ring, nil
+}
+
+func loadPrivateKey(path string) (*key, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var private interface{}
+	if private, err = x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+		if private, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("parse %s: not a PKCS#8 or PKCS#1 private key", path)
+		}
+	}
+
+	var public interface{}
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		public = &k.PublicKey
+	case ed25519.PrivateKey:
+		public = k.Public()
+	default:
+		return nil, fmt.Errorf("%s: unsupported key type %T", path, private)
+	}
+
+	signing, err := newKey(public)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	signing.private = private
+	return signing, nil
+}
+
+func loadPublicKey(path string) (*key, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	verify, err := newKey(public)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return verify, nil
+}
+
+// newKey picks the algorithm for a public key and names it by thumbprint.
+func newKey(public interface{}) (*key, error) {
+	k := &key{public: public}
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA keys must be at least %d bits", minRSABits)
+		}
+		k.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		k.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", public)
+	}
+	k.id = k.jwk().thumbprint()
+	return k, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+	return block, nil
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// JWK is the public half of a signing key as published in the JWKS.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS returns the public keys tokens are verified with, current signing key
+// first. Shared HS256 secrets are never published, so with HS256 only the
+// set is empty and other services can't verify tokens on their own.
+func JWKS() []JWK {
+	keys := []JWK{}
+	ring := current
+	if ring == nil {
+		return keys
+	}
+
+	ids := make([]string, 0, len(ring.verify))
+	for id := range ring.verify {
+		if id != ring.signing.id {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	ids = append([]string{ring.signing.id}, ids...)
+
+	for _, id := range ids {
+		k := ring.verify[id]
+		if _, symmetric := k.public.([]byte); symmetric {
+			continue
+		}
+		keys = append(keys, k.jwk())
+	}
+	return keys
+}
+
+func (k *key) jwk() JWK {
+	out := JWK{Use: "sig", Alg: k.method.Alg(), Kid: k.id}
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		out.Kty = "RSA"
+		out.N = b64(pub.N.Bytes())
+		out.E = b64(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		out.Kty = "OKP"
+		out.Crv = "Ed25519"
+		out.X = b64(pub)
+	}
+	return out
+}
+
+// thumbprint is the RFC 7638 SHA-256 thumbprint: the hash of the required
+// members in lexicographic order, without whitespace.
+func (j JWK) thumbprint() string {
+	var canonical string
+	switch j.Kty {
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, j.E, j.N)
+	case "OKP":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, j.Crv, j.X)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return b64(sum[:])
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
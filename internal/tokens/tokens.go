@@ -0,0 +1,108 @@
+// Package tokens issues and verifies the JWTs the service hands out: access
+// and refresh tokens, MFA challenges and the signed unlock and OIDC state
+// cookies. Every token carries a "typ" claim, and Parse only accepts the type
+// the caller asks for.
+package tokens
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Token types, stored in the "typ" claim.
+const (
+	TypeAccess    = "access"
+	TypeRefresh   = "refresh"
+	TypeMFA       = "mfa"
+	TypeUnlock    = "unlock"
+	TypeOIDCState = "oidc_state"
+)
+
+var (
+	// ErrNotConfigured is returned while no signing key is loaded, so a
+	// missing secret rejects every token instead of accepting forged ones.
+	ErrNotConfigured = errors.New("token signing is not configured")
+	ErrWrongType     = errors.New("unexpected token type")
+)
+
+// Issue signs claims as a token of the given type that expires after ttl.
+// typ, iss, aud, iat and exp are always set here; jti is added when the
+// caller didn't provide one.
+func Issue(typ string, claims jwt.MapClaims, ttl time.Duration) (string, error) {
+	ring := current
+	if ring == nil {
+		return "", ErrNotConfigured
+	}
+
+	now := time.Now()
+	signed := jwt.MapClaims{}
+	for k, v := range claims {
+		signed[k] = v
+	}
+	signed["typ"] = typ
+	signed["iss"] = ring.issuer
+	signed["aud"] = ring.audience
+	signed["iat"] = now.Unix()
+	signed["exp"] = now.Add(ttl).Unix()
+	if _, ok := signed["jti"]; !ok {
+		signed["jti"] = uuid.NewString()
+	}
+
+	key := ring.signing
+	token := jwt.NewWithClaims(key.method, signed)
+	token.Header["kid"] = key.id
+	return token.SignedString(key.private)
+}
+
+// Parse verifies a token and returns its claims. The signature must come
+// from a configured key with the algorithm that key is meant for, iss, aud
+// and exp must be present and valid, and typ must match.
+func Parse(raw, typ string) (jwt.MapClaims, error) {
+	ring := current
+	if ring == nil {
+		return nil, ErrNotConfigured
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, ring.keyFunc,
+		jwt.WithValidMethods(ring.methods()),
+		jwt.WithIssuer(ring.issuer),
+		jwt.WithAudience(ring.audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if claims["typ"] != typ {
+		return nil, ErrWrongType
+	}
+	return claims, nil
+}
+
+func (r *keyring) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, ok := r.verify[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if t.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("key %q does not sign with %s", kid, t.Method.Alg())
+	}
+	return key.public, nil
+}
+
+func (r *keyring) methods() []string {
+	seen := map[string]bool{}
+	var algs []string
+	for _, key := range r.verify {
+		if alg := key.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
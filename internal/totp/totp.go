@@ -0,0 +1,80 @@
+// Package totp implements RFC 6238 time-based one-time passwords with the
+// parameters authenticator apps expect: SHA-1, 6 digits, 30 second steps.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	period = 30
+	digits = 6
+	// codes from one step either side are accepted to allow for clock drift
+	skew = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a random base32 secret.
+func GenerateSecret() string {
+	b := make([]byte, 20)
+	rand.Read(b)
+	return encoding.EncodeToString(b)
+}
+
+// URI is the otpauth:// URI authenticator apps import, usually via QR code.
+func URI(issuer, account, secret string) string {
+	q := url.Values{
+		"secret":    {secret},
+		"issuer":    {issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(digits)},
+		"period":    {fmt.Sprint(period)},
+	}
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// Validate checks code against secret at time t. It returns the time step
+// the code belongs to, so callers can refuse a step that was already used.
+func Validate(secret, code string, t time.Time) (int64, bool) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) != digits {
+		return 0, false
+	}
+
+	current := t.Unix() / period
+	for step := current - skew; step <= current+skew; step++ {
+		if subtle.ConstantTimeCompare([]byte(generate(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func generate(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", digits, value%1000000)
+}
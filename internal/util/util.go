@@ -2,8 +2,14 @@ package util
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net"
+	"regexp"
 	"strconv"
+	"strings"
 	"url-shortener/internal/config"
 	"url-shortener/internal/models"
 
@@ -19,6 +25,121 @@ func GenerateShortCode() string {
 	return base64.URLEncoding.EncodeToString(bytes)[:8]
 }
 
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+var reservedAliases = map[string]bool{
+	"api":      true,
+	"admin":    true,
+	"redirect": true,
+	"url":      true,
+	"user":     true,
+	"users":    true,
+	"login":    true,
+	"logout":   true,
+	"register": true,
+	"test":     true,
+	"ping":     true,
+	"health":   true,
+	"static":   true,
+	"assets":   true,
+}
+
+const (
+	AliasMinLength = 3
+	AliasMaxLength = 32
+)
+
+// ValidateAlias checks a caller-supplied short code against the allowed
+// charset, length bounds and the reserved-word list.
+func ValidateAlias(alias string) error {
+	if len(alias) < AliasMinLength || len(alias) > AliasMaxLength {
+		return errors.New("alias must be between 3 and 32 characters")
+	}
+	if !aliasPattern.MatchString(alias) {
+		return errors.New("alias may only contain letters, digits, '-' and '_'")
+	}
+	if reservedAliases[strings.ToLower(alias)] {
+		return errors.New("alias is reserved")
+	}
+	return nil
+}
+
+// ResolveExpiry turns the expires_at / expires_in pair accepted by the URL
+// endpoints into an absolute expiry. expires_in takes a Go duration ("36h")
+// or a number of days ("7d").
+func ResolveExpiry(expiresAt *time.Time, expiresIn string) (*time.Time, error) {
+	if expiresAt != nil && expiresIn != "" {
+		return nil, errors.New("use either expires_at or expires_in, not both")
+	}
+
+	if expiresIn != "" {
+		d, err := ParseDuration(expiresIn)
+		if err != nil || d <= 0 {
+			return nil, errors.New("expires_in must be a positive duration such as 36h or 7d")
+		}
+		t := time.Now().Add(d)
+		expiresAt = &t
+	}
+
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, errors.New("expiry must be in the future")
+	}
+	return expiresAt, nil
+}
+
+// ParseDuration extends time.ParseDuration with a "d" (days) unit.
+func ParseDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// ValidRedirectStatus reports whether code is a redirect status a link may use.
+func ValidRedirectStatus(code int) bool {
+	switch code {
+	case 301, 302, 307, 308:
+		return true
+	}
+	return false
+}
+
+func ShortURL(shortCode string) string {
+	return config.PublicBaseURL() + "/" + shortCode
+}
+
+// ClientNetwork is the address per-IP limits count against: the client
+// IP for IPv4, and its /64 for IPv6, since a single host usually gets a whole
+// /64 and could otherwise rotate through it.
+func ClientNetwork(c *gin.Context) string {
+	ip := net.ParseIP(c.ClientIP())
+	if ip == nil {
+		return c.ClientIP()
+	}
+	if ip.To4() != nil {
+		return ip.String()
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}).String()
+}
+
+// GenerateSecureToken returns a random URL-safe token for links sent by email.
+func GenerateSecureToken() string {
+	bytes := make([]byte, 32)
+	rand.Read(bytes)
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
+
+// HashToken is how emailed tokens are stored; they are long and random, so an
+// unsalted SHA-256 is enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func ParseInt(s string) int {
 	i, _ := strconv.Atoi(s)
 	return i
@@ -38,11 +159,24 @@ func ResponseError(message string) models.APIResponse {
 	}
 }
 
+func ResponseErrorMeta(message string, meta interface{}) models.APIResponse {
+	return models.APIResponse{
+		Status:  false,
+		Message: message,
+		Meta:    meta,
+	}
+}
+
 func CleanupExpiredData() {
 	config.DB.Where("expires_at IS NOT NULL AND expires_at < ?", time.Now()).Delete(&models.URL{})
 
 	config.DB.Where("expires_at < ?", time.Now()).Delete(&models.GuestSession{})
 
+	config.DB.Where("expires_at < ?", time.Now()).Delete(&models.RefreshToken{})
+	config.DB.Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{})
+	config.DB.Where("expires_at < ?", time.Now()).Delete(&models.UserToken{})
+	config.DB.Where("expires_at < ? AND accepted_at IS NULL", time.Now()).Delete(&models.WorkspaceInvite{})
+
 	oneYearAgo := time.Now().AddDate(-1, 0, 0)
 	config.DB.Where("created_at < ?", oneYearAgo).Delete(&models.Click{})
 }
@@ -57,7 +191,15 @@ func GetTokenClaims(c *gin.Context) (jwt.MapClaims, bool) {
 	return tokenClaims, ok
 }
 
+// GetUserID returns the authenticated user, whether the request carried a
+// JWT or an API key.
 func GetUserID(c *gin.Context) (uint, bool) {
+	if id, ok := c.Get("user_id"); ok {
+		if userID, ok := id.(uint); ok {
+			return userID, true
+		}
+	}
+
 	claims, ok := GetTokenClaims(c)
 	if !ok {
 		return 0, false